@@ -0,0 +1,184 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+// This file implements a line-oriented unified diff for "pson fmt -d".
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the size of the table used to compute a minimal diff.
+// Beyond this, the differing region is reported as a single replacement.
+const maxDiffCells = 1 << 24
+
+// An edit is one line of a diff, marked ' ' (keep), '-' (delete), or '+'
+// (insert).
+type edit struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns a unified diff from the original contents a of the
+// named file to the formatted contents b, or "" if they are equal.
+func unifiedDiff(name string, a, b []byte) string {
+	edits := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	// Record the line numbers in a and b preceding each edit.
+	oldAt := make([]int, len(edits)+1)
+	newAt := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if e.op != '+' {
+			oldAt[i+1]++
+		}
+		if e.op != '-' {
+			newAt[i+1]++
+		}
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk until a run of unchanged lines long enough to
+		// separate it from the next change, or the end of the input.
+		start, end := max(i-diffContext, 0), i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			k := end
+			for k < len(edits) && edits[k].op == ' ' {
+				k++
+			}
+			if k == len(edits) || k-end > 2*diffContext {
+				end = min(end+diffContext, len(edits))
+				break
+			}
+			end = k
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s.orig\n+++ %s\n", name, name)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(oldAt[start], oldAt[end]), hunkRange(newAt[start], newAt[end]))
+		for _, e := range edits[start:end] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+// hunkRange formats the range of lines following line lo, up to and
+// including line hi, in the notation of a unified diff hunk header.
+func hunkRange(lo, hi int) string {
+	if hi == lo+1 {
+		return fmt.Sprint(hi)
+	} else if hi == lo {
+		return fmt.Sprintf("%d,0", lo)
+	}
+	return fmt.Sprintf("%d,%d", lo+1, hi-lo)
+}
+
+// splitLines splits s into lines, each including its trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a minimal sequence of edits transforming a into b.
+func diffLines(a, b []string) []edit {
+	var edits []edit
+
+	// Lines common to the start and end of both inputs are unchanged.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	post := 0
+	for post < len(a)-pre && post < len(b)-pre && a[len(a)-1-post] == b[len(b)-1-post] {
+		post++
+	}
+	for _, line := range a[:pre] {
+		edits = append(edits, edit{' ', line})
+	}
+	edits = append(edits, diffMiddle(a[pre:len(a)-post], b[pre:len(b)-post])...)
+	for _, line := range a[len(a)-post:] {
+		edits = append(edits, edit{' ', line})
+	}
+	return edits
+}
+
+// diffMiddle computes the edits from a to b by finding a longest common
+// subsequence of their lines.
+func diffMiddle(a, b []string) []edit {
+	var edits []edit
+	n, m := len(a), len(b)
+	if n*m > maxDiffCells {
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+		return edits
+	}
+
+	// lcs[i*(m+1)+j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) int32 { return lcs[i*(m+1)+j] }
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = at(i+1, j+1) + 1
+			} else {
+				lcs[i*(m+1)+j] = max(at(i+1, j), at(i, j+1))
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case at(i+1, j) >= at(i, j+1):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
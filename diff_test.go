@@ -0,0 +1,63 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// lines joins its arguments as newline-terminated lines.
+func lines(ss ...string) string {
+	if len(ss) == 0 {
+		return ""
+	}
+	return strings.Join(ss, "\n") + "\n"
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	const head = "--- f.orig\n+++ f\n"
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"Equal", lines("a", "b"), lines("a", "b"), ""},
+		{"Empty", "", "", ""},
+
+		{"ReplaceOnly", lines("a"), lines("b"), head + lines("@@ -1 +1 @@", "-a", "+b")},
+		{"DeleteFirst", lines("a", "b"), lines("b"), head + lines("@@ -1,2 +1 @@", "-a", " b")},
+		{"InsertIntoEmpty", "", lines("a"), head + lines("@@ -0,0 +1 @@", "+a")},
+		{"DeleteAll", lines("a"), "", head + lines("@@ -1 +0,0 @@", "-a")},
+
+		// Edits at the start and end of a file, far enough apart to need
+		// separate hunks with three lines of context each.
+		{"StartAndEnd",
+			lines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"),
+			lines("X", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "Y"),
+			head + lines(
+				"@@ -1,4 +1,4 @@", "-1", "+X", " 2", " 3", " 4",
+				"@@ -9,4 +9,4 @@", " 9", " 10", " 11", "-12", "+Y")},
+
+		// Edits close together share a hunk.
+		{"Merged",
+			lines("1", "2", "3", "4", "5", "6", "7", "8"),
+			lines("X", "2", "3", "4", "5", "6", "7", "Y"),
+			head + lines("@@ -1,8 +1,8 @@", "-1", "+X", " 2", " 3", " 4", " 5", " 6", " 7", "-8", "+Y")},
+
+		{"Middle",
+			lines("1", "2", "3", "4", "5", "6", "7", "8"),
+			lines("1", "2", "3", "4", "Z", "5", "6", "7", "8"),
+			head + lines("@@ -2,6 +2,7 @@", " 2", " 3", " 4", "+Z", " 5", " 6", " 7")},
+
+		{"NoFinalNewline", "a\nb", lines("a", "b"),
+			head + "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unifiedDiff("f", []byte(test.a), []byte(test.b)); got != test.want {
+				t.Errorf("unifiedDiff: got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+// This file implements the "pson fmt" subcommand.
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/creachadair/pson/textpb"
+	"github.com/creachadair/pson/textpb/format"
+)
+
+// canonical is the configuration for the house style enforced by pson fmt:
+// curly braces, two-space indentation, one field per line, a colon only
+// before primitive values, and no separators.
+var canonical = format.Config{Curly: true, Indent: "  "}
+
+// runFmt implements the fmt subcommand with the given arguments, and returns
+// the exit status of the program: 0 on success, 1 if -l or -d found a file
+// that is not formatted, and 2 if any file could not be processed.
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	doWrite := fs.Bool("w", false, "Write the result to each file instead of stdout")
+	doList := fs.Bool("l", false, "List files whose formatting differs from the canonical style")
+	doDiff := fs.Bool("d", false, "Display diffs instead of rewriting files")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `Usage: pson fmt [-w] [-l] [-d] <file>...
+
+Reformats each named file (or stdin if none are named) as a text-format
+protobuf message in the canonical style, and writes the result to stdout.
+Comments are preserved. With -l or -d, the exit status is 1 if any file is
+not already formatted. If any file cannot be read or parsed, the others are
+still processed, and the exit status is 2.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		if *doWrite {
+			fmt.Fprintln(stderr, "Cannot use -w with standard input")
+			return 2
+		}
+		paths = append(paths, "-")
+	}
+
+	status := 0
+	for _, path := range paths {
+		src, err := readSource(path, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "Reading %q failed: %v\n", path, err)
+			status = 2
+			continue
+		}
+		out, err := formatSource(src)
+		if err != nil {
+			fmt.Fprintf(stderr, "Parsing %q failed: %v\n", path, err)
+			status = 2
+			continue
+		}
+		changed := !bytes.Equal(src, out)
+		if changed && (*doList || *doDiff) && status == 0 {
+			status = 1
+		}
+
+		if *doList && changed {
+			fmt.Fprintln(stdout, path)
+		}
+		if *doDiff && changed {
+			fmt.Fprint(stdout, unifiedDiff(path, src, out))
+		}
+		if *doWrite {
+			if changed {
+				if err := writeFile(path, out); err != nil {
+					fmt.Fprintf(stderr, "Writing %q failed: %v\n", path, err)
+					status = 2
+				}
+			}
+		} else if !*doList && !*doDiff {
+			stdout.Write(out)
+		}
+	}
+	return status
+}
+
+// readSource returns the contents of the named file, or of stdin if path is
+// "-".
+func readSource(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// formatSource returns the text-format message in src rendered in the
+// canonical style. If src contains no fields it is returned unchanged.
+func formatSource(src []byte) ([]byte, error) {
+	msg, err := textpb.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	} else if len(msg) == 0 {
+		return src, nil
+	}
+	var buf bytes.Buffer
+	if err := canonical.Text(&buf, msg); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// writeFile replaces the contents of the existing file at path with data,
+// preserving its permissions.
+func writeFile(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, fi.Mode().Perm())
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatSource(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"# only a comment\n", "# only a comment\n"},
+		{"a:1 b:'x'", "a: 1\nb: \"x\"\n"},
+		{"a < b: 1 c: [2, 3] >", "a {\n  b: 1\n  c: 2\n  c: 3\n}\n"},
+		{"# lead\na: 1 # line\n\nb {}\n", "# lead\na: 1 # line\nb {}\n"},
+	}
+	for _, test := range tests {
+		got, err := formatSource([]byte(test.input))
+		if err != nil {
+			t.Errorf("formatSource %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("formatSource %q: got %q, want %q", test.input, got, test.want)
+		}
+
+		// Formatting the output again must not change it.
+		again, err := formatSource(got)
+		if err != nil {
+			t.Errorf("formatSource %q: unexpected error: %v", got, err)
+		} else if !bytes.Equal(again, got) {
+			t.Errorf("formatSource is not idempotent: %q became %q", got, again)
+		}
+	}
+}
+
+func TestRunFmt(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	good := write("good.txt", "a: 1\n")
+	bad := write("bad.txt", "a:1\n")
+	broken := write("broken.txt", "a: {\n")
+	missing := filepath.Join(dir, "missing.txt")
+
+	tests := []struct {
+		args   []string
+		status int
+		stdout string
+	}{
+		{[]string{good}, 0, "a: 1\n"},
+		{[]string{"-l", good}, 0, ""},
+		{[]string{"-d", good}, 0, ""},
+		{[]string{"-l", good, bad}, 1, bad + "\n"},
+		{[]string{"-d", bad}, 1, "--- " + bad + ".orig\n+++ " + bad + "\n@@ -1 +1 @@\n-a:1\n+a: 1\n"},
+
+		// Files that cannot be read or parsed are reported, and the remaining
+		// files are still processed.
+		{[]string{"-l", missing, bad}, 2, bad + "\n"},
+		{[]string{"-l", bad, broken}, 2, bad + "\n"},
+		{[]string{missing, good}, 2, "a: 1\n"},
+		{[]string{"-nosuchflag"}, 2, ""},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		status := runFmt(test.args, strings.NewReader(""), &stdout, &stderr)
+		if status != test.status {
+			t.Errorf("fmt %q: got status %d, want %d (stderr: %s)", test.args, status, test.status, stderr.String())
+		}
+		if got := stdout.String(); got != test.stdout {
+			t.Errorf("fmt %q: got output %q, want %q", test.args, got, test.stdout)
+		}
+	}
+
+	// Standard input is read when no files are named.
+	var stdout bytes.Buffer
+	if status := runFmt(nil, strings.NewReader("a:1"), &stdout, &stdout); status != 0 {
+		t.Errorf("fmt stdin: got status %d, want 0", status)
+	} else if got, want := stdout.String(), "a: 1\n"; got != want {
+		t.Errorf("fmt stdin: got %q, want %q", got, want)
+	}
+
+	// With -w, unformatted files are rewritten in place.
+	if status := runFmt([]string{"-w", bad}, nil, &stdout, &stdout); status != 0 {
+		t.Errorf("fmt -w: got status %d, want 0", status)
+	} else if data, err := os.ReadFile(bad); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(data), "a: 1\n"; got != want {
+		t.Errorf("fmt -w: file contains %q, want %q", got, want)
+	}
+}
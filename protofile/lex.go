@@ -0,0 +1,313 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package protofile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Pos is a position in a source file.
+type Pos struct {
+	Line, Col int // 1-based; Col counts bytes
+}
+
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Col) }
+
+// An Error is an error in a source file, annotated with its position.
+type Error struct {
+	File string
+	Pos  Pos
+	Msg  string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s:%v: %s", e.File, e.Pos, e.Msg) }
+
+// tokKind identifies the kind of a token.
+type tokKind int
+
+const (
+	tEOF    tokKind = iota
+	tIdent          // identifier or keyword
+	tInt            // integer literal
+	tFloat          // floating-point literal
+	tString         // string literal, with escapes decoded
+	tPunct          // a single punctuation character
+)
+
+func (k tokKind) String() string {
+	switch k {
+	case tEOF:
+		return "end of input"
+	case tIdent:
+		return "identifier"
+	case tInt:
+		return "integer"
+	case tFloat:
+		return "number"
+	case tString:
+		return "string"
+	}
+	return "punctuation"
+}
+
+type token struct {
+	kind tokKind
+	text string
+	pos  Pos
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tEOF:
+		return t.kind.String()
+	case tString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// A lexer splits .proto source text into tokens. Comments and whitespace are
+// discarded.
+type lexer struct {
+	file string
+	src  string
+	off  int
+	pos  Pos
+}
+
+func newLexer(file, src string) *lexer {
+	return &lexer{file: file, src: strings.TrimPrefix(src, "\ufeff"), pos: Pos{Line: 1, Col: 1}}
+}
+
+func (l *lexer) errorf(pos Pos, msg string, args ...any) error {
+	return errorf(l.file, pos, msg, args...)
+}
+
+func errorf(file string, pos Pos, msg string, args ...any) error {
+	return &Error{File: file, Pos: pos, Msg: fmt.Sprintf(msg, args...)}
+}
+
+// advance consumes n bytes of input, updating the position.
+func (l *lexer) advance(n int) {
+	for _, c := range []byte(l.src[l.off : l.off+n]) {
+		if c == '\n' {
+			l.pos.Line++
+			l.pos.Col = 1
+		} else {
+			l.pos.Col++
+		}
+	}
+	l.off += n
+}
+
+// skip consumes whitespace and comments.
+func (l *lexer) skip() error {
+	for l.off < len(l.src) {
+		rest := l.src[l.off:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r' || rest[0] == '\f' || rest[0] == '\v':
+			l.advance(1)
+		case strings.HasPrefix(rest, "//"):
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			l.advance(n)
+		case strings.HasPrefix(rest, "/*"):
+			n := strings.Index(rest[2:], "*/")
+			if n < 0 {
+				return l.errorf(l.pos, "unterminated comment")
+			}
+			l.advance(n + 4)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// next returns the next token of the input.
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	pos := l.pos
+	if l.off == len(l.src) {
+		return token{kind: tEOF, pos: pos}, nil
+	}
+	rest := l.src[l.off:]
+	c := rest[0]
+	switch {
+	case isLetter(c):
+		n := 1
+		for n < len(rest) && (isLetter(rest[n]) || isDigit(rest[n])) {
+			n++
+		}
+		l.advance(n)
+		return token{kind: tIdent, text: rest[:n], pos: pos}, nil
+
+	case isDigit(c) || (c == '.' && len(rest) > 1 && isDigit(rest[1])):
+		return l.number(pos)
+
+	case c == '"' || c == '\'':
+		return l.string(pos)
+	}
+	if strings.IndexByte("{}[]()<>;,=.-+:/", c) < 0 {
+		r, _ := utf8.DecodeRuneInString(rest)
+		return token{}, l.errorf(pos, "unexpected character %q", r)
+	}
+	l.advance(1)
+	return token{kind: tPunct, text: rest[:1], pos: pos}, nil
+}
+
+// number scans a numeric literal.
+func (l *lexer) number(pos Pos) (token, error) {
+	rest := l.src[l.off:]
+	n, float := 0, false
+	hex := strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0X")
+	for n < len(rest) {
+		c := rest[n]
+		if isLetter(c) || isDigit(c) || c == '.' {
+			if !hex && (c == '.' || c == 'e' || c == 'E') {
+				float = true
+			}
+			n++
+		} else if (c == '-' || c == '+') && !hex && (rest[n-1] == 'e' || rest[n-1] == 'E') {
+			n++
+		} else {
+			break
+		}
+	}
+	text := rest[:n]
+	l.advance(n)
+	if float {
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return token{}, l.errorf(pos, "invalid number %q", text)
+		}
+		return token{kind: tFloat, text: text, pos: pos}, nil
+	}
+	if !validInt(text) {
+		return token{}, l.errorf(pos, "invalid integer %q", text)
+	}
+	return token{kind: tInt, text: text, pos: pos}, nil
+}
+
+// string scans a quoted string literal and decodes its escapes.
+func (l *lexer) string(pos Pos) (token, error) {
+	rest := l.src[l.off:]
+	quote := rest[0]
+	var buf strings.Builder
+	for i := 1; i < len(rest); {
+		c := rest[i]
+		switch {
+		case c == quote:
+			l.advance(i + 1)
+			return token{kind: tString, text: buf.String(), pos: pos}, nil
+		case c == '\n':
+			i = len(rest) // unterminated
+		case c == '\\':
+			n, err := unescape(&buf, rest[i:])
+			if err != nil {
+				l.advance(i)
+				return token{}, l.errorf(l.pos, "%v", err)
+			}
+			i += n
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return token{}, l.errorf(pos, "unterminated string")
+}
+
+// unescape decodes the escape sequence at the beginning of s into buf, and
+// returns the length of the sequence.
+func unescape(buf *strings.Builder, s string) (int, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid escape sequence %q", s)
+	}
+	switch c := s[1]; c {
+	case 'a':
+		buf.WriteByte('\a')
+	case 'b':
+		buf.WriteByte('\b')
+	case 'f':
+		buf.WriteByte('\f')
+	case 'n':
+		buf.WriteByte('\n')
+	case 'r':
+		buf.WriteByte('\r')
+	case 't':
+		buf.WriteByte('\t')
+	case 'v':
+		buf.WriteByte('\v')
+	case '\\', '\'', '"', '?':
+		buf.WriteByte(c)
+	case 'x', 'X':
+		n := 2
+		for n < len(s) && n < 4 && isHexDigit(s[n]) {
+			n++
+		}
+		if n == 2 {
+			return 0, fmt.Errorf("invalid escape sequence %q", s[:2])
+		}
+		v, _ := strconv.ParseUint(s[2:n], 16, 8)
+		buf.WriteByte(byte(v))
+		return n, nil
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if len(s) < 2+n {
+			return 0, fmt.Errorf("invalid escape sequence %q", s)
+		}
+		v, err := strconv.ParseUint(s[2:2+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(v)) {
+			return 0, fmt.Errorf("invalid escape sequence %q", s[:2+n])
+		}
+		buf.WriteRune(rune(v))
+		return 2 + n, nil
+	default:
+		if c < '0' || c > '7' {
+			return 0, fmt.Errorf("invalid escape sequence %q", s[:2])
+		}
+		n := 2
+		for n < len(s) && n < 4 && isOctalDigit(s[n]) {
+			n++
+		}
+		v, _ := strconv.ParseUint(s[1:n], 8, 16)
+		if v > 255 {
+			return 0, fmt.Errorf("invalid escape sequence %q", s[:n])
+		}
+		buf.WriteByte(byte(v))
+		return n, nil
+	}
+	return 2, nil
+}
+
+// validInt reports whether s is a valid decimal, octal, or hexadecimal
+// integer literal that fits in 64 bits.
+func validInt(s string) bool {
+	digits, ok := s, isDigit
+	if len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X") {
+		digits, ok = s[2:], isHexDigit
+	} else if len(s) > 1 && s[0] == '0' {
+		digits, ok = s[1:], isOctalDigit
+	}
+	for i := 0; i < len(digits); i++ {
+		if !ok(digits[i]) {
+			return false
+		}
+	}
+	_, err := strconv.ParseUint(s, 0, 64)
+	return err == nil
+}
+
+func isLetter(c byte) bool     { return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool      { return '0' <= c && c <= '9' }
+func isOctalDigit(c byte) bool { return '0' <= c && c <= '7' }
+func isHexDigit(c byte) bool   { return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' }
@@ -0,0 +1,187 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package protofile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/creachadair/pson/wirepb"
+)
+
+// Load parses the named .proto files and the files they import, and returns a
+// schema containing all their types. Files are named by their paths relative
+// to one of the directories in importPaths, which are searched in order, as
+// with the -I flag of protoc. If importPaths is empty, the current directory
+// is searched.
+//
+// A type name that does not refer to a known type is reported as an *Error
+// giving its position.
+//
+// An import of one of the well-known types in "google/protobuf/" that is not
+// found in importPaths is satisfied by a built-in copy of its definitions, or
+// by an empty file if there is none.
+func Load(importPaths []string, files ...string) (*wirepb.Schema, error) {
+	if len(importPaths) == 0 {
+		importPaths = []string{"."}
+	}
+	ld := &loader{
+		paths: importPaths,
+		done:  make(map[string]bool),
+		types: make(map[*wirepb.FieldDesc]Pos),
+	}
+	for _, name := range files {
+		if err := ld.load(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := ld.checkTypes(); err != nil {
+		return nil, err
+	}
+	return wirepb.NewSchema(ld.files...)
+}
+
+// A loader parses files and their imports, recording each file once.
+type loader struct {
+	paths []string
+	done  map[string]bool // files loaded, or being loaded
+	files []*wirepb.FileDesc
+	types map[*wirepb.FieldDesc]Pos // the positions of unresolved type names
+}
+
+// load parses the named file and its imports. The stack gives the names of
+// the files importing it, to detect cycles.
+func (ld *loader) load(name string, stack []string) error {
+	if ld.done[name] {
+		for _, s := range stack {
+			if s == name {
+				return fmt.Errorf("import cycle: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+		return nil
+	}
+	ld.done[name] = true
+
+	fd, err := ld.parse(name)
+	if err != nil {
+		return err
+	}
+	stack = append(stack, name)
+	for _, dep := range fd.Dependencies {
+		if err := ld.load(dep, stack); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("%s: import %q: %w", name, dep, err)
+			}
+			return err
+		}
+	}
+	ld.files = append(ld.files, fd)
+	return nil
+}
+
+// parse finds the named file on the import path and parses it.
+func (ld *loader) parse(name string) (*wirepb.FileDesc, error) {
+	for _, dir := range ld.paths {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ld.parseFrom(name, f)
+	}
+	if strings.HasPrefix(name, "google/protobuf/") {
+		if src, ok := wellKnown[name]; ok {
+			return ld.parseFrom(name, strings.NewReader(src))
+		}
+		return &wirepb.FileDesc{Name: name, Package: "google.protobuf"}, nil
+	}
+	return nil, fmt.Errorf("file %q: %w", name, fs.ErrNotExist)
+}
+
+// parseFrom parses the contents of r as the named file, and records the
+// positions of its type names.
+func (ld *loader) parseFrom(name string, r io.Reader) (*wirepb.FileDesc, error) {
+	p, err := parse(name, r)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(ld.types, p.types)
+	return p.fd, nil
+}
+
+// checkTypes reports an *Error for the first field whose type name does not
+// refer to a type defined in the loaded files. Names are resolved as for
+// wirepb.NewSchema.
+func (ld *loader) checkTypes() error {
+	defined := make(map[string]bool)
+	var define func(scope string, msgs []*wirepb.MessageDesc, enums []*wirepb.EnumDesc)
+	define = func(scope string, msgs []*wirepb.MessageDesc, enums []*wirepb.EnumDesc) {
+		for _, e := range enums {
+			defined[qualify(scope, e.Name)] = true
+		}
+		for _, m := range msgs {
+			full := qualify(scope, m.Name)
+			defined[full] = true
+			define(full, m.Nested, m.Enums)
+		}
+	}
+	for _, fd := range ld.files {
+		define(fd.Package, fd.Messages, fd.Enums)
+	}
+
+	var check func(file, scope string, msgs []*wirepb.MessageDesc) error
+	check = func(file, scope string, msgs []*wirepb.MessageDesc) error {
+		for _, m := range msgs {
+			full := qualify(scope, m.Name)
+			for _, f := range m.Fields {
+				pos, ok := ld.types[f]
+				if ok && !resolves(defined, full, f.TypeName) {
+					return errorf(file, pos, "unknown type %q", f.TypeName)
+				}
+			}
+			if err := check(file, full, m.Nested); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, fd := range ld.files {
+		if err := check(fd.Name, fd.Package, fd.Messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolves reports whether name refers to a defined type when it is looked
+// up from the given scope, beginning there and working outward.
+func resolves(defined map[string]bool, scope, name string) bool {
+	if full, ok := strings.CutPrefix(name, "."); ok {
+		return defined[full]
+	}
+	for {
+		if defined[qualify(scope, name)] {
+			return true
+		} else if scope == "" {
+			return false
+		}
+		i := strings.LastIndex(scope, ".")
+		scope = scope[:max(i, 0)]
+	}
+}
+
+// qualify returns name qualified by the given scope.
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
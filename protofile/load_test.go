@@ -0,0 +1,110 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package protofile_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/pson/protofile"
+	"github.com/creachadair/pson/textpb"
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeFiles writes the given files, mapping relative paths to their
+// contents, into a new temporary directory, and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(path, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app/main.proto": `syntax = "proto3";
+package app;
+import "lib/common.proto";
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/descriptor.proto";
+message Event {
+  lib.Kind kind = 1;
+  google.protobuf.Timestamp when = 2;
+  map<string, lib.Tag> tags = 3;
+  repeated int32 codes = 4;
+}`,
+		"lib/common.proto": `syntax = "proto3";
+package lib;
+enum Kind { UNKNOWN = 0; START = 1; STOP = 2; }
+message Tag { string value = 1; }`,
+	})
+	s, err := protofile.Load([]string{dir}, "app/main.proto")
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	m := s.Message("app.Event")
+	if m == nil {
+		t.Fatal("Message app.Event not found")
+	}
+
+	in, err := textpb.Parse(strings.NewReader(`kind: STOP when { seconds: 1500000000 nanos: 5 }
+tags { key: "a" value { value: "x" } } codes: 1 codes: 2 codes: 300`))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	data, err := m.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode: unexpected error: %v", err)
+	}
+	if got, want := string(data),
+		"\010\002\022\010\010\200\336\240\313\005\020\005\032\010\012\001a\022\003\012\001x\042\004\001\002\254\002"; got != want {
+		t.Errorf("Encode: got %q, want %q", got, want)
+	}
+	out, err := m.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(in.Combine(), out.Combine()); diff != "" {
+		t.Errorf("Decode: wrong result (-want, +got):\n%s", diff)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.proto":   `import "b.proto";`,
+		"b.proto":   `import "a.proto";`,
+		"c.proto":   `import "missing.proto";`,
+		"d.proto":   `message D { optional Nope x = 1; }`,
+		"f.proto":   "syntax = \"proto3\";\npackage f;\nmessage F {\n  message G {}\n  G g = 1;\n  map<string, f.H> h = 2;\n}",
+		"i.proto":   "import \"k.proto\";\nmessage I { optional .k.K.L l = 1; optional k.K.M m = 2; }",
+		"k.proto":   "package k; message K { message L {} }",
+		"bad.proto": "syntax = \"proto3\";\nmessage {}",
+		"e.proto":   `import "bad.proto";`,
+	})
+	tests := []struct {
+		file, want string
+	}{
+		{"a.proto", "import cycle: a.proto -> b.proto -> a.proto"},
+		{"c.proto", `c.proto: import "missing.proto": file "missing.proto": file does not exist`},
+		{"d.proto", `d.proto:1:22: unknown type "Nope"`},
+		{"f.proto", `f.proto:6:15: unknown type "f.H"`},
+		{"i.proto", `i.proto:2:45: unknown type "k.K.M"`},
+		{"e.proto", "bad.proto:2:9: expected identifier, got \"{\""},
+		{"none.proto", `file "none.proto": file does not exist`},
+	}
+	for _, test := range tests {
+		_, err := protofile.Load([]string{dir}, test.file)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Load %q: got error %v, want %q", test.file, err, test.want)
+		}
+	}
+}
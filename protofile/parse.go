@@ -0,0 +1,857 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+// Package protofile parses protocol buffer schema definitions (.proto files)
+// into the descriptors used by wirepb to decode and encode typed messages.
+//
+// The parser accepts proto2, proto3, and editions syntax. It records the
+// parts of a schema needed to encode and decode messages: packages, imports,
+// messages, enums, nested types, oneofs, maps, and groups. Services,
+// extensions, and most options are checked for syntax and then discarded.
+package protofile
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/pson/wirepb"
+)
+
+// maxFieldNumber is the largest valid field number.
+const maxFieldNumber = 1<<29 - 1
+
+// scalarTypes maps the names of scalar types to their field types.
+var scalarTypes = map[string]wirepb.Type{
+	"double": wirepb.TypeDouble, "float": wirepb.TypeFloat,
+	"int64": wirepb.TypeInt64, "uint64": wirepb.TypeUint64,
+	"int32": wirepb.TypeInt32, "fixed64": wirepb.TypeFixed64,
+	"fixed32": wirepb.TypeFixed32, "bool": wirepb.TypeBool,
+	"string": wirepb.TypeString, "bytes": wirepb.TypeBytes,
+	"uint32": wirepb.TypeUint32, "sfixed32": wirepb.TypeSfixed32,
+	"sfixed64": wirepb.TypeSfixed64, "sint32": wirepb.TypeSint32,
+	"sint64": wirepb.TypeSint64,
+}
+
+// Parse parses the contents of r as a .proto file with the given name. The
+// type names of fields are not resolved; use wirepb.NewSchema or Load for
+// that. A syntax error, or a field number used twice in one message, is
+// reported as an *Error giving its position.
+func Parse(name string, r io.Reader) (*wirepb.FileDesc, error) {
+	p, err := parse(name, r)
+	if err != nil {
+		return nil, err
+	}
+	return p.fd, nil
+}
+
+// parse parses the contents of r as for Parse, and returns the parser, which
+// records the positions of the type names of fields.
+func parse(name string, r io.Reader) (*parser, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lex := newLexer(name, string(data))
+	var toks []token
+	for {
+		t, err := lex.next()
+		if err != nil {
+			return nil, err
+		}
+		toks = append(toks, t)
+		if t.kind == tEOF {
+			break
+		}
+	}
+	p := &parser{
+		file:   name,
+		toks:   toks,
+		fd:     &wirepb.FileDesc{Name: name},
+		packed: make(map[*wirepb.MessageDesc]*bool),
+		types:  make(map[*wirepb.FieldDesc]Pos),
+		nums:   make(map[*wirepb.FieldDesc]token),
+	}
+	if err := p.parseFile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// A parser consumes the tokens of a .proto file.
+type parser struct {
+	file string
+	toks []token
+	pos  int // offset of the next unconsumed token
+	fd   *wirepb.FileDesc
+
+	// The repeated field encodings set by editions features, for the file as
+	// a whole and for each message that sets one.
+	filePacked *bool
+	packed     map[*wirepb.MessageDesc]*bool
+
+	types map[*wirepb.FieldDesc]Pos   // the positions of unresolved type names
+	nums  map[*wirepb.FieldDesc]token // the field number tokens
+}
+
+// An option is the name and value of an option setting.
+type option struct {
+	name string // e.g., "packed", "(my.ext).field"
+	val  constant
+}
+
+// A constant is the value of an option.
+type constant struct {
+	tok  token   // the first token of the value
+	kind tokKind // tIdent, tInt, tFloat, tString; tPunct for an aggregate
+	text string  // a signed number includes its sign; a string is decoded
+}
+
+func (p *parser) errorf(t token, msg string, args ...any) error {
+	return errorf(p.file, t.pos, msg, args...)
+}
+
+// peek returns the nth unconsumed token, where 0 is the next.
+func (p *parser) peek(n int) token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+// next consumes and returns the next token.
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the nth unconsumed token is an identifier or punctuation
+// with the given text.
+func (p *parser) is(n int, text string) bool {
+	t := p.peek(n)
+	return (t.kind == tIdent || t.kind == tPunct) && t.text == text
+}
+
+// accept consumes the next token if it has the given text, and reports
+// whether it did so.
+func (p *parser) accept(text string) bool {
+	if p.is(0, text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); (t.kind != tIdent && t.kind != tPunct) || t.text != text {
+		return p.errorf(t, "expected %q, got %v", text, t)
+	}
+	return nil
+}
+
+func (p *parser) ident() (token, error) {
+	t := p.next()
+	if t.kind != tIdent {
+		return t, p.errorf(t, "expected identifier, got %v", t)
+	}
+	return t, nil
+}
+
+// fullIdent parses a dotted name, as "a.b.c".
+func (p *parser) fullIdent() (string, error) {
+	var parts []string
+	for {
+		t, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, t.text)
+		if !p.accept(".") {
+			return strings.Join(parts, "."), nil
+		}
+	}
+}
+
+// typeName parses a type name, which may be fully-qualified with a leading ".".
+func (p *parser) typeName() (string, error) {
+	if p.accept(".") {
+		name, err := p.fullIdent()
+		return "." + name, err
+	}
+	return p.fullIdent()
+}
+
+// str parses a string constant. Adjacent strings are concatenated.
+func (p *parser) str() (string, error) {
+	t := p.next()
+	if t.kind != tString {
+		return "", p.errorf(t, "expected string, got %v", t)
+	}
+	s := t.text
+	for p.peek(0).kind == tString {
+		s += p.next().text
+	}
+	return s, nil
+}
+
+// skipStatement consumes tokens through the next ";".
+func (p *parser) skipStatement() error {
+	for {
+		if t := p.next(); t.kind == tEOF {
+			return p.errorf(t, "expected \";\", got %v", t)
+		} else if t.kind == tPunct && t.text == ";" {
+			return nil
+		}
+	}
+}
+
+// skipBlock consumes a block enclosed in braces, including nested blocks.
+func (p *parser) skipBlock() error {
+	open := p.peek(0)
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		t := p.next()
+		switch {
+		case t.kind == tEOF:
+			return p.errorf(open, "unclosed \"{\"")
+		case t.kind != tPunct:
+		case t.text == "{":
+			depth++
+		case t.text == "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseFile() error {
+	if p.is(0, "syntax") || p.is(0, "edition") {
+		if err := p.parseSyntax(); err != nil {
+			return err
+		}
+	}
+	for {
+		t := p.peek(0)
+		if t.kind == tEOF {
+			if p.fd.Syntax == "editions" {
+				p.applyPacked(p.fd.Messages, p.filePacked)
+			}
+			return nil
+		} else if t.kind != tIdent && !p.is(0, ";") {
+			return p.errorf(t, "unexpected %v", t)
+		}
+		var err error
+		switch t.text {
+		case ";":
+			p.next()
+		case "syntax", "edition":
+			err = p.errorf(t, "%s must be the first statement", t.text)
+		case "package":
+			p.next()
+			if p.fd.Package != "" {
+				return p.errorf(t, "duplicate package statement")
+			} else if p.fd.Package, err = p.fullIdent(); err == nil {
+				err = p.expect(";")
+			}
+		case "import":
+			p.next()
+			_ = p.accept("public") || p.accept("weak")
+			var path string
+			if path, err = p.str(); err == nil {
+				p.fd.Dependencies = append(p.fd.Dependencies, path)
+				err = p.expect(";")
+			}
+		case "option":
+			var opt option
+			if opt, err = p.option(); err == nil {
+				err = p.setFeature(opt, &p.filePacked)
+			}
+		case "message":
+			var m *wirepb.MessageDesc
+			if m, err = p.message(); err == nil {
+				p.fd.Messages = append(p.fd.Messages, m)
+			}
+		case "enum":
+			var e *wirepb.EnumDesc
+			if e, err = p.enum(); err == nil {
+				p.fd.Enums = append(p.fd.Enums, e)
+			}
+		case "service", "extend":
+			p.next()
+			if _, err = p.typeName(); err == nil {
+				err = p.skipBlock()
+			}
+		default:
+			err = p.errorf(t, "unexpected %v", t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseSyntax parses a syntax or edition statement.
+func (p *parser) parseSyntax() error {
+	kw := p.next()
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	vt := p.peek(0)
+	val, err := p.str()
+	if err != nil {
+		return err
+	}
+	if kw.text == "edition" {
+		p.fd.Syntax = "editions"
+	} else if val == "proto2" || val == "proto3" {
+		p.fd.Syntax = val
+	} else {
+		return p.errorf(vt, "unknown syntax %q", val)
+	}
+	return p.expect(";")
+}
+
+// option parses an option statement.
+func (p *parser) option() (option, error) {
+	p.next() // "option"
+	opt, err := p.optionSetting()
+	if err != nil {
+		return opt, err
+	}
+	return opt, p.expect(";")
+}
+
+// optionList parses a bracketed list of options, if one is present.
+func (p *parser) optionList() ([]option, error) {
+	if !p.accept("[") {
+		return nil, nil
+	}
+	var opts []option
+	for {
+		opt, err := p.optionSetting()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+		if !p.accept(",") {
+			return opts, p.expect("]")
+		}
+	}
+}
+
+// optionSetting parses an option name and its value, as "name = value".
+func (p *parser) optionSetting() (option, error) {
+	var parts []string
+	for {
+		if p.accept("(") {
+			name, err := p.typeName()
+			if err != nil {
+				return option{}, err
+			} else if err := p.expect(")"); err != nil {
+				return option{}, err
+			}
+			parts = append(parts, "("+name+")")
+		} else {
+			t, err := p.ident()
+			if err != nil {
+				return option{}, err
+			}
+			parts = append(parts, t.text)
+		}
+		if !p.accept(".") {
+			break
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return option{}, err
+	}
+	val, err := p.constant()
+	return option{name: strings.Join(parts, "."), val: val}, err
+}
+
+// constant parses the value of an option. An aggregate value in braces is
+// skipped, and its text is empty.
+func (p *parser) constant() (constant, error) {
+	t := p.peek(0)
+	switch {
+	case t.kind == tString:
+		s, err := p.str()
+		return constant{tok: t, kind: tString, text: s}, err
+	case t.kind == tIdent || t.kind == tInt || t.kind == tFloat:
+		p.next()
+		return constant{tok: t, kind: t.kind, text: t.text}, nil
+	case p.is(0, "-") || p.is(0, "+"):
+		p.next()
+		v := p.next()
+		if v.kind != tInt && v.kind != tFloat && !(v.kind == tIdent && (v.text == "inf" || v.text == "nan")) {
+			return constant{}, p.errorf(v, "expected number, got %v", v)
+		}
+		text := v.text
+		if t.text == "-" {
+			text = "-" + text
+		}
+		return constant{tok: t, kind: v.kind, text: text}, nil
+	case p.is(0, "{"):
+		return constant{tok: t, kind: tPunct}, p.skipBlock()
+	}
+	return constant{}, p.errorf(t, "expected constant, got %v", t)
+}
+
+// setFeature records the repeated field encoding set by opt, if it is an
+// editions feature setting one, in *packed.
+func (p *parser) setFeature(opt option, packed **bool) error {
+	if opt.name != "features.repeated_field_encoding" {
+		return nil
+	}
+	b, err := p.encoding(opt.val)
+	if err == nil {
+		*packed = &b
+	}
+	return err
+}
+
+// encoding reports whether a repeated_field_encoding feature value is PACKED.
+func (p *parser) encoding(val constant) (bool, error) {
+	switch val.text {
+	case "PACKED":
+		return true, nil
+	case "EXPANDED":
+		return false, nil
+	}
+	return false, p.errorf(val.tok, "invalid repeated_field_encoding %q", val.text)
+}
+
+// applyPacked sets the packed option of the repeated fields of msgs that do
+// not set their own, from the encoding features of their scope.
+func (p *parser) applyPacked(msgs []*wirepb.MessageDesc, inherited *bool) {
+	for _, m := range msgs {
+		packed := inherited
+		if v := p.packed[m]; v != nil {
+			packed = v
+		}
+		for _, f := range m.Fields {
+			if f.IsRepeated() && f.Packed == nil {
+				f.Packed = packed
+			}
+		}
+		p.applyPacked(m.Nested, packed)
+	}
+}
+
+// message parses a message definition.
+func (p *parser) message() (*wirepb.MessageDesc, error) {
+	p.next() // "message"
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	m := &wirepb.MessageDesc{Name: name.text}
+	return m, p.messageBody(m)
+}
+
+// isDecl reports whether the next tokens begin a declaration of the given
+// kind, as "message Name {", rather than a field whose type has that name.
+func (p *parser) isDecl(kind string) bool {
+	return p.is(0, kind) && p.peek(1).kind == tIdent && p.is(2, "{")
+}
+
+// messageBody parses the body of a message or group, in braces, into m.
+func (p *parser) messageBody(m *wirepb.MessageDesc) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		var err error
+		switch t := p.peek(0); {
+		case t.kind == tEOF:
+			return p.errorf(t, "unexpected end of input in message %s", m.Name)
+		case p.accept("}"):
+			return p.checkNumbers(m)
+		case p.accept(";"):
+		case p.isDecl("message"):
+			var nm *wirepb.MessageDesc
+			if nm, err = p.message(); err == nil {
+				m.Nested = append(m.Nested, nm)
+			}
+		case p.isDecl("enum"):
+			var e *wirepb.EnumDesc
+			if e, err = p.enum(); err == nil {
+				m.Enums = append(m.Enums, e)
+			}
+		case p.isDecl("oneof"):
+			err = p.oneof(m)
+		case p.is(0, "extend") && !p.is(2, "="):
+			p.next()
+			if _, err = p.typeName(); err == nil {
+				err = p.skipBlock()
+			}
+		case p.is(0, "option"):
+			var opt option
+			if opt, err = p.option(); err == nil {
+				packed := p.packed[m]
+				err = p.setFeature(opt, &packed)
+				p.packed[m] = packed
+			}
+		case p.is(0, "reserved"), p.is(0, "extensions"):
+			err = p.skipStatement()
+		default:
+			err = p.field(m, -1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkNumbers reports an error if two fields of m have the same number.
+func (p *parser) checkNumbers(m *wirepb.MessageDesc) error {
+	seen := make(map[int]string)
+	for _, f := range m.Fields {
+		if prev, ok := seen[f.Number]; ok {
+			return p.errorf(p.nums[f], "field number %d is already used by %q", f.Number, prev)
+		}
+		seen[f.Number] = f.Name
+	}
+	return nil
+}
+
+// oneof parses a oneof definition in message m.
+func (p *parser) oneof(m *wirepb.MessageDesc) error {
+	p.next() // "oneof"
+	name := p.next()
+	index := len(m.Oneofs)
+	m.Oneofs = append(m.Oneofs, name.text)
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		var err error
+		switch t := p.peek(0); {
+		case t.kind == tEOF:
+			return p.errorf(t, "unexpected end of input in oneof %s", name.text)
+		case p.accept("}"):
+			return nil
+		case p.accept(";"):
+		case p.is(0, "option"):
+			_, err = p.option()
+		default:
+			err = p.field(m, index)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// field parses a field definition in message m, including a map or group
+// field. If oneof ≥ 0, the field belongs to the oneof with that index.
+func (p *parser) field(m *wirepb.MessageDesc, oneof int) error {
+	syntax := p.fd.Syntax
+	if syntax == "" {
+		syntax = "proto2"
+	}
+	fd := &wirepb.FieldDesc{Label: wirepb.LabelOptional, OneofIndex: oneof}
+
+	start := p.peek(0)
+	hasLabel := false
+	switch start.text {
+	case "optional", "required", "repeated":
+		if start.kind != tIdent || p.is(1, "=") {
+			break
+		}
+		hasLabel = true
+		p.next()
+		if oneof >= 0 {
+			return p.errorf(start, "fields in a oneof must not have labels")
+		} else if start.text == "required" && syntax != "proto2" || start.text == "optional" && syntax == "editions" {
+			return p.errorf(start, "label %q is not allowed in %s", start.text, syntax)
+		}
+		if start.text == "required" {
+			fd.Label = wirepb.LabelRequired
+		} else if start.text == "repeated" {
+			fd.Label = wirepb.LabelRepeated
+		}
+	}
+
+	switch {
+	case p.is(0, "map") && p.is(1, "<"):
+		if hasLabel {
+			return p.errorf(start, "map fields must not have labels")
+		} else if oneof >= 0 {
+			return p.errorf(start, "map fields are not allowed in a oneof")
+		}
+		return p.mapField(m, fd)
+
+	case p.is(0, "group") && p.peek(1).kind == tIdent && p.is(2, "="):
+		if syntax != "proto2" {
+			return p.errorf(start, "groups are not allowed in %s", syntax)
+		} else if !hasLabel && oneof < 0 {
+			return p.errorf(start, "missing label for group")
+		}
+		return p.groupField(m, fd)
+	}
+	if !hasLabel && oneof < 0 && syntax == "proto2" {
+		return p.errorf(start, "missing label for field")
+	}
+
+	tpos := p.peek(0).pos
+	tname, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	if t, ok := scalarTypes[tname]; ok {
+		fd.Type = t
+	} else {
+		fd.TypeName = tname
+		p.types[fd] = tpos
+	}
+	if err := p.fieldTail(fd); err != nil {
+		return err
+	}
+	m.Fields = append(m.Fields, fd)
+	return p.expect(";")
+}
+
+// fieldTail parses the name, number, and options of a field into fd.
+func (p *parser) fieldTail(fd *wirepb.FieldDesc) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	fd.Name = name.text
+	fd.JSONName = jsonName(fd.Name)
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	num := p.next()
+	if num.kind != tInt {
+		return p.errorf(num, "expected field number, got %v", num)
+	}
+	p.nums[fd] = num
+	v, _ := strconv.ParseUint(num.text, 0, 64)
+	if v < 1 || v > maxFieldNumber {
+		return p.errorf(num, "field number %s out of range", num.text)
+	} else if v >= 19000 && v <= 19999 {
+		return p.errorf(num, "field number %s is reserved", num.text)
+	}
+	fd.Number = int(v)
+
+	opts, err := p.optionList()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		if err := p.fieldOption(fd, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldOption applies opt to the field fd, if it is one that affects the
+// encoding of fd. Other options are ignored.
+func (p *parser) fieldOption(fd *wirepb.FieldDesc, opt option) error {
+	switch opt.name {
+	case "packed":
+		if opt.val.text != "true" && opt.val.text != "false" {
+			return p.errorf(opt.val.tok, "invalid value %q for packed", opt.val.text)
+		}
+		packed := opt.val.text == "true"
+		fd.Packed = &packed
+	case "default":
+		if p.fd.Syntax == "proto3" {
+			return p.errorf(opt.val.tok, "default values are not allowed in proto3")
+		}
+		fd.Default = opt.val.text
+	case "json_name":
+		if opt.val.kind != tString {
+			return p.errorf(opt.val.tok, "json_name must be a string")
+		}
+		fd.JSONName = opt.val.text
+	case "features.repeated_field_encoding":
+		packed, err := p.encoding(opt.val)
+		if err != nil {
+			return err
+		}
+		fd.Packed = &packed
+	case "features.message_encoding":
+		switch opt.val.text {
+		case "DELIMITED":
+			if fd.Type != 0 {
+				return p.errorf(opt.val.tok, "message_encoding applies only to message fields")
+			}
+			fd.Type = wirepb.TypeGroup
+		case "LENGTH_PREFIXED":
+		default:
+			return p.errorf(opt.val.tok, "invalid message_encoding %q", opt.val.text)
+		}
+	}
+	return nil
+}
+
+// mapField parses a map field into fd, and adds it and its entry type to m.
+func (p *parser) mapField(m *wirepb.MessageDesc, fd *wirepb.FieldDesc) error {
+	p.next() // "map"
+	p.next() // "<"
+	kt, err := p.ident()
+	if err != nil {
+		return err
+	}
+	key, ok := scalarTypes[kt.text]
+	if !ok || key == wirepb.TypeDouble || key == wirepb.TypeFloat || key == wirepb.TypeBytes {
+		return p.errorf(kt, "invalid map key type %q", kt.text)
+	}
+	if err := p.expect(","); err != nil {
+		return err
+	}
+	vpos := p.peek(0).pos
+	vname, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(">"); err != nil {
+		return err
+	}
+	val := &wirepb.FieldDesc{
+		Name: "value", Number: 2, Label: wirepb.LabelOptional, JSONName: "value", OneofIndex: -1,
+	}
+	if t, ok := scalarTypes[vname]; ok {
+		val.Type = t
+	} else {
+		val.TypeName = vname
+		p.types[val] = vpos
+	}
+	if err := p.fieldTail(fd); err != nil {
+		return err
+	}
+	entry := &wirepb.MessageDesc{
+		Name:     mapEntryName(fd.Name),
+		MapEntry: true,
+		Fields: []*wirepb.FieldDesc{{
+			Name: "key", Number: 1, Label: wirepb.LabelOptional, Type: key, JSONName: "key", OneofIndex: -1,
+		}, val},
+	}
+	fd.Label = wirepb.LabelRepeated
+	fd.Type = wirepb.TypeMessage
+	fd.TypeName = entry.Name
+	m.Nested = append(m.Nested, entry)
+	m.Fields = append(m.Fields, fd)
+	return p.expect(";")
+}
+
+// groupField parses a group field into fd, and adds it and its type to m.
+func (p *parser) groupField(m *wirepb.MessageDesc, fd *wirepb.FieldDesc) error {
+	p.next() // "group"
+	name := p.peek(0)
+	if c := name.text[0]; c < 'A' || c > 'Z' {
+		return p.errorf(name, "group name %q must begin with a capital letter", name.text)
+	}
+	if err := p.fieldTail(fd); err != nil {
+		return err
+	}
+	fd.Name = strings.ToLower(name.text)
+	fd.JSONName = jsonName(fd.Name)
+	fd.Type = wirepb.TypeGroup
+	fd.TypeName = name.text
+
+	group := &wirepb.MessageDesc{Name: name.text}
+	if err := p.messageBody(group); err != nil {
+		return err
+	}
+	m.Nested = append(m.Nested, group)
+	m.Fields = append(m.Fields, fd)
+	return nil
+}
+
+// enum parses an enum definition.
+func (p *parser) enum() (*wirepb.EnumDesc, error) {
+	p.next() // "enum"
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	e := &wirepb.EnumDesc{Name: name.text}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for {
+		switch t := p.peek(0); {
+		case t.kind == tEOF:
+			return nil, p.errorf(t, "unexpected end of input in enum %s", e.Name)
+		case p.accept("}"):
+			return e, nil
+		case p.accept(";"):
+		case p.is(0, "option") && !p.is(1, "="):
+			if _, err := p.option(); err != nil {
+				return nil, err
+			}
+		case p.is(0, "reserved") && !p.is(1, "="):
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		default:
+			v, err := p.enumValue()
+			if err != nil {
+				return nil, err
+			}
+			e.Values = append(e.Values, v)
+		}
+	}
+}
+
+// enumValue parses the definition of an enum value.
+func (p *parser) enumValue() (*wirepb.EnumValueDesc, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	} else if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	neg := p.accept("-")
+	num := p.next()
+	if num.kind != tInt {
+		return nil, p.errorf(num, "expected enum value number, got %v", num)
+	}
+	u, _ := strconv.ParseUint(num.text, 0, 64)
+	v := int64(u)
+	if neg {
+		v = -v
+	}
+	if u > 1<<31 || v > 1<<31-1 {
+		return nil, p.errorf(num, "enum value %s out of range", num.text)
+	}
+	if _, err := p.optionList(); err != nil {
+		return nil, err
+	}
+	return &wirepb.EnumValueDesc{Name: name.text, Number: int32(v)}, p.expect(";")
+}
+
+// jsonName returns the default JSON name of a field, as for a field named
+// "string_values" the name is "stringValues".
+func jsonName(name string) string { return camelCase(name, false) }
+
+// mapEntryName returns the name of the entry type of a map field, as for a
+// field named "string_values" the name is "StringValuesEntry".
+func mapEntryName(name string) string { return camelCase(name, true) + "Entry" }
+
+// camelCase removes the underscores from name and capitalizes the letters
+// that follow them, and the first letter if upper is true.
+func camelCase(name string, upper bool) string {
+	var buf strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upper = true
+			continue
+		} else if upper && 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
@@ -0,0 +1,218 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package protofile_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/pson/protofile"
+	"github.com/creachadair/pson/wirepb"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var ignoreUnexported = cmpopts.IgnoreUnexported(wirepb.MessageDesc{}, wirepb.FieldDesc{})
+
+func parse(t *testing.T, src string) *wirepb.FileDesc {
+	t.Helper()
+	fd, err := protofile.Parse("test.proto", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	return fd
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestParseProto2(t *testing.T) {
+	fd := parse(t, `
+// A comment.
+syntax = "proto2";
+package a.b;
+
+import "other.proto";
+import public "google/protobuf/any.proto";
+option java_package = "com.example" /* trailing */ ".a";
+option (my.opt).name = { x: 1 y { z: "}" } };
+
+message M {
+  optional int32 id = 1 [default = -5, deprecated = true];
+  repeated sint64 vals = 0x2 [packed = true];
+  required .a.b.Kind kind = 3 [default = ZERO];
+  optional group Result = 4 {
+    optional string url = 1 [json_name = "URL"];
+  }
+  oneof choice {
+    string name = 5;
+    M other = 6;
+  }
+  map<string, Kind> by_name = 7;
+  reserved 10 to 20, 100 to max;
+  reserved "old";
+  extensions 1000 to 1999;
+  extend M { optional int32 ext = 1000; }
+  enum E { option allow_alias = true; X = 0; Y = 0 [deprecated = true]; }
+}
+
+enum Kind {
+  ZERO = 0;
+  NEG = -1;
+  BIG = 017;
+}
+
+service S {
+  rpc Call(M) returns (M) { option (x) = true; }
+}
+`)
+	want := &wirepb.FileDesc{
+		Name:         "test.proto",
+		Package:      "a.b",
+		Syntax:       "proto2",
+		Dependencies: []string{"other.proto", "google/protobuf/any.proto"},
+		Messages: []*wirepb.MessageDesc{{
+			Name: "M",
+			Fields: []*wirepb.FieldDesc{
+				{Name: "id", Number: 1, Label: wirepb.LabelOptional, Type: wirepb.TypeInt32,
+					JSONName: "id", Default: "-5", OneofIndex: -1},
+				{Name: "vals", Number: 2, Label: wirepb.LabelRepeated, Type: wirepb.TypeSint64,
+					JSONName: "vals", OneofIndex: -1, Packed: ptr(true)},
+				{Name: "kind", Number: 3, Label: wirepb.LabelRequired, TypeName: ".a.b.Kind",
+					JSONName: "kind", Default: "ZERO", OneofIndex: -1},
+				{Name: "result", Number: 4, Label: wirepb.LabelOptional, Type: wirepb.TypeGroup,
+					TypeName: "Result", JSONName: "result", OneofIndex: -1},
+				{Name: "name", Number: 5, Label: wirepb.LabelOptional, Type: wirepb.TypeString,
+					JSONName: "name", OneofIndex: 0},
+				{Name: "other", Number: 6, Label: wirepb.LabelOptional, TypeName: "M",
+					JSONName: "other", OneofIndex: 0},
+				{Name: "by_name", Number: 7, Label: wirepb.LabelRepeated, Type: wirepb.TypeMessage,
+					TypeName: "ByNameEntry", JSONName: "byName", OneofIndex: -1},
+			},
+			Nested: []*wirepb.MessageDesc{{
+				Name: "Result",
+				Fields: []*wirepb.FieldDesc{
+					{Name: "url", Number: 1, Label: wirepb.LabelOptional, Type: wirepb.TypeString,
+						JSONName: "URL", OneofIndex: -1},
+				},
+			}, {
+				Name:     "ByNameEntry",
+				MapEntry: true,
+				Fields: []*wirepb.FieldDesc{
+					{Name: "key", Number: 1, Label: wirepb.LabelOptional, Type: wirepb.TypeString,
+						JSONName: "key", OneofIndex: -1},
+					{Name: "value", Number: 2, Label: wirepb.LabelOptional, TypeName: "Kind",
+						JSONName: "value", OneofIndex: -1},
+				},
+			}},
+			Enums:  []*wirepb.EnumDesc{{Name: "E", Values: []*wirepb.EnumValueDesc{{Name: "X"}, {Name: "Y"}}}},
+			Oneofs: []string{"choice"},
+		}},
+		Enums: []*wirepb.EnumDesc{{Name: "Kind", Values: []*wirepb.EnumValueDesc{
+			{Name: "ZERO", Number: 0}, {Name: "NEG", Number: -1}, {Name: "BIG", Number: 15},
+		}}},
+	}
+	if diff := cmp.Diff(want, fd, ignoreUnexported); diff != "" {
+		t.Errorf("Parse: wrong result (-want, +got):\n%s", diff)
+	}
+}
+
+func TestParseProto3(t *testing.T) {
+	fd := parse(t, `syntax = 'proto3';
+message M {
+  int32 count = 1;
+  optional string label_text = 2;
+  repeated double xs = 3;
+  repeated fixed32 ys = 4 [packed = false];
+  message N { bytes data = 1; }
+  N n = 5;
+  ;
+}`)
+	m := fd.Messages[0]
+	if got, want := fd.Syntax, "proto3"; got != want {
+		t.Errorf("Syntax: got %q, want %q", got, want)
+	}
+	for i, want := range []string{"count", "labelText", "xs", "ys", "n"} {
+		if got := m.Fields[i].JSONName; got != want {
+			t.Errorf("Field %d JSON name: got %q, want %q", i, got, want)
+		}
+	}
+	if f := m.Fields[3]; f.Packed == nil || *f.Packed {
+		t.Errorf("Field ys: got packed %v, want false", f.Packed)
+	}
+	if f := m.Fields[4]; f.Type != 0 || f.TypeName != "N" {
+		t.Errorf("Field n: got %v %q, want unresolved N", f.Type, f.TypeName)
+	}
+}
+
+func TestParseEditions(t *testing.T) {
+	fd := parse(t, `edition = "2023";
+package e;
+option features.repeated_field_encoding = EXPANDED;
+message A {
+  repeated int32 x = 1;
+  repeated int32 y = 2 [features.repeated_field_encoding = PACKED];
+  A child = 3 [features.message_encoding = DELIMITED];
+  message B {
+    option features.repeated_field_encoding = PACKED;
+    repeated int32 z = 1;
+  }
+}`)
+	if got, want := fd.Syntax, "editions"; got != want {
+		t.Errorf("Syntax: got %q, want %q", got, want)
+	}
+	a := fd.Messages[0]
+	b := a.Nested[0]
+	tests := []struct {
+		field *wirepb.FieldDesc
+		want  bool
+	}{
+		{a.Fields[0], false},
+		{a.Fields[1], true},
+		{b.Fields[0], true},
+	}
+	for _, test := range tests {
+		if test.field.Packed == nil || *test.field.Packed != test.want {
+			t.Errorf("Field %q: got packed %v, want %v", test.field.Name, test.field.Packed, test.want)
+		}
+	}
+	if got := a.Fields[2].Type; got != wirepb.TypeGroup {
+		t.Errorf("Field child: got type %v, want %v", got, wirepb.TypeGroup)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`syntax = "proto4";`, `test.proto:1:10: unknown syntax "proto4"`},
+		{`package a; syntax = "proto3";`, `test.proto:1:12: syntax must be the first statement`},
+		{`message M {`, `test.proto:1:12: unexpected end of input in message M`},
+		{`message M { int32 x = 1; }`, `test.proto:1:13: missing label for field`},
+		{"syntax = \"proto3\";\nmessage M {\n  int32 x = 0;\n}", `test.proto:3:13: field number 0 out of range`},
+		{`syntax = "proto3"; message M { int32 x = 19001; }`, `test.proto:1:42: field number 19001 is reserved`},
+		{`syntax = "proto3"; message M { required int32 x = 1; }`, `test.proto:1:32: label "required" is not allowed in proto3`},
+		{`syntax = "proto3"; message M { int32 x = 1 [default = 3]; }`, `test.proto:1:55: default values are not allowed in proto3`},
+		{`syntax = "proto3"; message M { map<float, int32> m = 1; }`, `test.proto:1:36: invalid map key type "float"`},
+		{`syntax = "proto3"; message M { oneof o { repeated int32 x = 1; } }`, `test.proto:1:42: fields in a oneof must not have labels`},
+		{`message M { optional group g = 1 {} }`, `test.proto:1:28: group name "g" must begin with a capital letter`},
+		{`enum E { X = 2147483648; }`, `test.proto:1:14: enum value 2147483648 out of range`},
+		{`message M { optional string s = 1 [default = "\q"]; }`, `test.proto:1:47: invalid escape sequence "\\q"`},
+		{`message M { optional int32 x = 08; }`, `test.proto:1:32: invalid integer "08"`},
+		{`message M { optional int32 x = 1 }`, `test.proto:1:34: expected ";", got "}"`},
+		{`message M @`, `test.proto:1:11: unexpected character '@'`},
+		{`/* open`, `test.proto:1:1: unterminated comment`},
+		{`service S {`, `test.proto:1:11: unclosed "{"`},
+		{`message M { optional int32 x = 1; optional int32 y = 1; }`, `test.proto:1:54: field number 1 is already used by "x"`},
+		{`message M { oneof o { int32 x = 1; } optional group G = 1 {} }`, `test.proto:1:57: field number 1 is already used by "x"`},
+	}
+	for _, test := range tests {
+		_, err := protofile.Parse("test.proto", strings.NewReader(test.src))
+		var perr *protofile.Error
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse %q: got error %v, want *Error", test.src, err)
+		} else if got := err.Error(); got != test.want {
+			t.Errorf("Parse %q: got error %q, want %q", test.src, got, test.want)
+		}
+	}
+}
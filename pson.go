@@ -5,15 +5,26 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"iter"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/creachadair/pson/protofile"
 	"github.com/creachadair/pson/textpb"
+	"github.com/creachadair/pson/textpb/cbor"
 	"github.com/creachadair/pson/textpb/format"
+	"github.com/creachadair/pson/textpb/msgpack"
+	"github.com/creachadair/pson/textpb/yaml"
+	"github.com/creachadair/pson/wirepb"
 )
 
 var (
@@ -21,25 +32,66 @@ var (
 	indent     = flag.String("indent", "", "Indentation marker (enables indentation)")
 	doSplit    = flag.Bool("split", false, "Split into single-valued messages")
 	doRecur    = flag.Bool("rsplit", false, "Split recursively (implies -split)")
+	splitOn    = flag.String("split-on", "", "Split only along these comma-separated field paths (e.g., a.b)")
+	splitLimit = flag.Int("split-limit", 0, "Maximum number of messages to produce when splitting (0 means no limit)")
 	doCamel    = flag.Bool("camel", false, "Convert names to camel-case")
+	doStream   = flag.Bool("stream", false, "Stream JSON output without combining fields (bounded memory)")
+	doProto3   = flag.Bool("protojson", false, "Approximate the proto3 JSON mapping (int64 strings, camelCase names, @type)")
 	doProto1   = flag.Bool("proto1", false, "Render output as text-format protobuf (old style)")
 	doProto2   = flag.Bool("proto2", false, "Render output as text-format protobuf (new style)")
+	lineWidth  = flag.Int("width", 0, "Fit -proto1 and -proto2 output to this line width (enables indentation)")
+	doLists    = flag.Bool("lists", false, `Write repeated fields in list syntax ("name: [a, b]") in -proto1 and -proto2 output`)
+	msgColon   = flag.Bool("msg-colon", false, "Write a colon before message values in -proto1 and -proto2 output")
+	fieldSep   = flag.String("sep", "", `Separator between fields in -proto1 and -proto2 output ("", ",", or ";")`)
+	inFormat   = flag.String("from", "text", "Input format (text, yaml, json, wire)")
+	outFormat  = flag.String("to", "json", "Output format (json, csv, tsv, yaml, cbor, msgpack, wire)")
+	joinSep    = flag.String("join", "", "Join repeated values in CSV and TSV output with this separator")
+	doCanon    = flag.Bool("canonical", false, "Canonicalize messages: sort fields, remove duplicate values, and normalize numbers")
+	fieldOrder = flag.String("order", "", "Comma-separated field names or paths to put first when canonicalizing (implies -canonical)")
+	sortBy     = flag.String("sort-by", "", "Comma-separated path=key pairs to sort repeated fields by when canonicalizing (implies -canonical)")
+	doJSONL    = flag.Bool("jsonl", false, "Write JSON Lines: one compact JSON object per line")
+	framing    = flag.String("framing", "", "Read or write wire format as a stream of length-prefixed records (varint, fixed32)")
+	maxRecord  = flag.Int("max-record", 0, "Maximum record size in bytes with -framing (0 means 64MiB)")
+	schemaFile = flag.String("schema", "", "Decode or encode wire format using this .proto file or descriptor set (from protoc --descriptor_set_out)")
+	typeName   = flag.String("type", "", "Fully-qualified message type of wire input or output with -schema (e.g., pkg.Msg)")
+	doEnvelope = flag.Bool("envelope", false, `Wrap each line of -jsonl output as {"file":...,"index":n,"record":{...}}`)
 )
 
 func init() {
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, `Usage: pson <file>...
+       pson fmt [-w] [-l] [-d] <file>...
 
 Reads the contents of each named file (or stdin if none are named) as a
 text-format [1] protobuf message, converts each message to JSON, and catenates
-the resulting JSON values to stdout.
+the resulting JSON values to stdout. With -jsonl, each JSON value is written
+compactly on a line of its own, and -envelope records the source file and
+index of each value.
+
+Use -from and -to to select different input and output formats. YAML input may
+contain several documents separated by "---", each of which is converted as a
+separate message. CSV and TSV output flatten each message into a row of
+columns named by dotted field paths. CBOR and MessagePack output writes each
+message as a binary map, with no separators between messages. Wire input
+decodes a binary protobuf message without its schema, like protoc
+--decode_raw, naming fields by number. With -framing, wire input is a stream
+of length-prefixed records, each of which is converted as a separate message.
+With -schema and -type, wire input is decoded using the named message type
+from a .proto file or a compiled descriptor set, so that fields and enum
+values are named. The imports of a .proto file are found relative to its
+directory, or the current directory. Wire output requires -schema and -type,
+and writes each message in binary; with -framing, each message is a separate
+record.
 
 This is intended to bridge between tools that know how to emit text-format
 protobuf messages, but not JSON. You can use jq [2] to manipulate JSON messages
 with ease, but there is no analogue of this for text-format protobufs.
 
-The translation done by this tool is purely lexical; it does not know the
-schema of the underlying protobuf messages.
+The fmt subcommand rewrites text-format files in a canonical style; run
+"pson fmt -help" for details.
+
+Except with -schema, the translation done by this tool is purely lexical; it
+does not know the schema of the underlying protobuf messages.
 
 [1] https://developers.google.com/protocol-buffers/docs/reference/cpp/google.protobuf.text_format
 [2] https://stedolan.github.io/jq/
@@ -49,48 +101,277 @@ Options:`)
 	}
 }
 
+// msgType is the message type of wire input, if known.
+var msgType *wirepb.MessageDesc
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFmt(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
 	flag.Parse()
 
 	paths := flag.Args()
 	if len(paths) == 0 {
 		paths = append(paths, "-")
 	}
+	if *doStream && (*doSplit || *doRecur || *splitOn != "" || *doProto1 || *doProto2) {
+		log.Fatal("The -stream flag cannot be combined with splitting, -proto1, or -proto2")
+	} else if *splitOn != "" && (*doSplit || *doRecur) {
+		log.Fatal("The -split-on flag cannot be combined with -split or -rsplit")
+	} else if *outFormat != "json" && (*doStream || *doProto1 || *doProto2) {
+		log.Fatal("The -to flag cannot be combined with -stream, -proto1, or -proto2")
+	} else if *inFormat != "text" && *doStream {
+		log.Fatal("The -stream flag requires text input")
+	} else if *doJSONL && (*indent != "" || *linePrefix != "" || *outFormat != "json" || *doProto1 || *doProto2) {
+		log.Fatal("The -jsonl flag requires JSON output without -indent or -prefix")
+	} else if *doEnvelope && (!*doJSONL || *doStream) {
+		log.Fatal("The -envelope flag requires -jsonl and cannot be combined with -stream")
+	} else if *doStream && (*doCanon || *fieldOrder != "" || *sortBy != "") {
+		log.Fatal("The -stream flag cannot be combined with canonicalization")
+	} else if *framing != "" && *inFormat != "wire" && *outFormat != "wire" {
+		log.Fatal("The -framing flag requires -from=wire or -to=wire")
+	} else if _, err := recordFraming(); *framing != "" && err != nil {
+		log.Fatalf("Invalid -framing flag: %v", err)
+	} else if (*schemaFile != "" || *typeName != "") && (*schemaFile == "" || *typeName == "") {
+		log.Fatal("The -schema and -type flags must be used together")
+	} else if *schemaFile != "" && *inFormat != "wire" && *outFormat != "wire" {
+		log.Fatal("The -schema flag requires -from=wire or -to=wire")
+	} else if *outFormat == "wire" && *schemaFile == "" {
+		log.Fatal("Output with -to=wire requires -schema and -type")
+	}
+	if *schemaFile != "" {
+		msgType = loadType()
+	}
+	write, flush := outputFormat()
 
 	for _, path := range paths {
 		path, in := mustOpen(path)
-		msg, err := textpb.Parse(in)
-		if err != nil {
-			log.Fatalf("Parsing %q failed: %v", path, err)
+		if *doStream {
+			if err := streamMessage(os.Stdout, in); err != nil {
+				log.Fatalf("Converting %q failed: %v", path, err)
+			}
+			in.Close()
+			continue
+		}
+		msgs := func(yield func(textpb.Message) bool) {
+			for msg := range readMessages(path, in) {
+				for out := range splitMessage(path, msg) {
+					if !yield(out) {
+						return
+					}
+				}
+			}
+		}
+		if *doCanon || *fieldOrder != "" || *sortBy != "" {
+			msgs = canonicalize(msgs)
+		}
+		if *doEnvelope {
+			msgs = envelope(path, msgs)
+		}
+		if err := write(os.Stdout, msgs); err != nil {
+			log.Fatalf("Error writing output: %v", err)
 		}
 		in.Close()
+	}
+	if err := flush(os.Stdout); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
 
-		// If requested, split the message into single-valued messages;
-		// otherwise combine the (single) top-level message.
-		write := writeMessages
-		if *doProto1 || *doProto2 {
-			write = writeProtos
+// readMessages returns the messages read from r. With -framing and wire
+// input, each record of the input is decoded as a separate message, and each
+// document of YAML input is a separate message; otherwise r contains a single
+// message in the selected input format.
+func readMessages(path string, r io.Reader) iter.Seq[textpb.Message] {
+	return func(yield func(textpb.Message) bool) {
+		if *inFormat == "yaml" {
+			msgs, err := yaml.DecodeAll(r)
+			if err != nil {
+				log.Fatalf("Parsing %q failed: %v", path, err)
+			}
+			for _, msg := range msgs {
+				if !yield(msg) {
+					return
+				}
+			}
+			return
+		} else if *framing == "" || *inFormat != "wire" {
+			msg, err := readMessage(r)
+			if err != nil {
+				log.Fatalf("Parsing %q failed: %v", path, err)
+			}
+			yield(msg)
+			return
 		}
-		if *doRecur {
-			err = write(os.Stdout, msg.RSplit()...)
-		} else if *doSplit {
-			err = write(os.Stdout, msg.Split()...)
-		} else {
-			err = write(os.Stdout, msg.Combine())
+		frame, _ := recordFraming() // checked in main
+		rr := wirepb.NewRecordReader(r, frame)
+		rr.MaxSize = *maxRecord
+		for i := 0; ; i++ {
+			rec, err := rr.Next()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				log.Fatalf("Reading record %d of %q failed: %v", i, path, err)
+			}
+			msg, err := decodeWire(rec)
+			if err != nil {
+				log.Fatalf("Parsing record %d of %q failed: %v", i, path, err)
+			}
+			if !yield(msg) {
+				return
+			}
 		}
+	}
+}
+
+// decodeWire decodes a wire-format message, using the -schema and -type flags
+// if they are set.
+func decodeWire(data []byte) (textpb.Message, error) {
+	if msgType == nil {
+		return wirepb.DecodeRaw(bytes.NewReader(data))
+	}
+	return msgType.Decode(data)
+}
+
+// loadType returns the message type named by the -type flag, from the .proto
+// file or descriptor set named by the -schema flag.
+func loadType() *wirepb.MessageDesc {
+	var s *wirepb.Schema
+	var err error
+	if strings.HasSuffix(*schemaFile, ".proto") {
+		dir, base := filepath.Split(*schemaFile)
+		s, err = protofile.Load([]string{filepath.Clean(dir), "."}, base)
+	} else {
+		var f *os.File
+		f, err = os.Open(*schemaFile)
 		if err != nil {
-			log.Fatalf("Error writing JSON output: %v", err)
+			log.Fatalf("Open failed: %v", err)
 		}
+		defer f.Close()
+		s, err = wirepb.ReadSchema(f)
+	}
+	if err != nil {
+		log.Fatalf("Reading schema %q failed: %v", *schemaFile, err)
 	}
+	m := s.Message(*typeName)
+	if m == nil {
+		log.Fatalf("Message type %q not found in %q", *typeName, *schemaFile)
+	}
+	return m
+}
+
+// recordFraming returns the framing selected by the -framing flag. It reports
+// an error if the flag does not name a known framing.
+func recordFraming() (wirepb.Framing, error) {
+	switch *framing {
+	case "varint":
+		return wirepb.FrameVarint, nil
+	case "fixed32":
+		return wirepb.FrameFixed32, nil
+	}
+	return 0, fmt.Errorf("unknown record framing %q", *framing)
 }
 
-func writeMessages(w io.Writer, msgs ...textpb.Message) error {
+// splitMessage returns the messages to output for msg: If requested, msg is
+// split into single-valued messages; otherwise the combined message.
+func splitMessage(path string, msg textpb.Message) iter.Seq[textpb.Message] {
+	if !*doRecur && !*doSplit && *splitOn == "" {
+		return slices.Values([]textpb.Message{msg.Combine()})
+	}
+	msgs, err := msg.SplitWith(textpb.SplitOptions{
+		Recursive: *doRecur,
+		Paths:     splitPaths(*splitOn),
+		Limit:     *splitLimit,
+	})
+	if err != nil {
+		log.Fatalf("Splitting %q failed: %v", path, err)
+	}
+	return msgs
+}
+
+// readMessage reads a message from r in the selected input format.
+func readMessage(r io.Reader) (textpb.Message, error) {
+	switch *inFormat {
+	case "text":
+		return textpb.Parse(r)
+	case "yaml":
+		return yaml.Decode(r)
+	case "json":
+		return textpb.ParseJSON(r)
+	case "wire":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return decodeWire(data)
+	}
+	return nil, fmt.Errorf("unknown input format %q", *inFormat)
+}
+
+// outputFormat returns a function that writes messages in the selected output
+// format, and a function to finish the output after all messages are written.
+func outputFormat() (write func(io.Writer, iter.Seq[textpb.Message]) error, flush func(io.Writer) error) {
+	noFlush := func(io.Writer) error { return nil }
+	if *doProto1 || *doProto2 {
+		return writeProtos, noFlush
+	}
+	switch *outFormat {
+	case "json":
+		return writeMessages, noFlush
+	case "csv", "tsv":
+		// The header is the union of the columns of all the records, so the
+		// table must be complete before it can be written.
+		tab := textpb.NewTable(textpb.FlattenOptions{Join: *joinSep})
+		addRows := func(_ io.Writer, msgs iter.Seq[textpb.Message]) error {
+			for msg := range msgs {
+				tab.Add(msg)
+			}
+			return nil
+		}
+		if *outFormat == "tsv" {
+			return addRows, tab.WriteTSV
+		}
+		return addRows, func(w io.Writer) error { return tab.WriteCSV(w, ',') }
+	case "yaml":
+		return writeYAML(), noFlush
+	case "cbor":
+		return writeBinary(cbor.Encode), noFlush
+	case "msgpack":
+		return writeBinary(msgpack.Encode), noFlush
+	case "wire":
+		return writeWire()
+	}
+	log.Fatalf("Unknown output format %q", *outFormat)
+	panic("unreachable")
+}
+
+// splitPaths parses a comma-separated list of field paths.
+func splitPaths(s string) []string {
+	var paths []string
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func writeMessages(w io.Writer, msgs iter.Seq[textpb.Message]) error {
 	enc := json.NewEncoder(w)
 	enc.SetIndent(*linePrefix, *indent)
-	for _, out := range msgs {
+	for out := range msgs {
 		if *doCamel {
 			out.ToCamel()
 		}
+		if *doProto3 {
+			data, err := textpb.Proto3JSON.Marshal(out)
+			if err != nil {
+				return err
+			} else if err := enc.Encode(json.RawMessage(data)); err != nil {
+				return err
+			}
+			continue
+		}
 		if err := enc.Encode(out); err != nil {
 			return err
 		}
@@ -98,13 +379,161 @@ func writeMessages(w io.Writer, msgs ...textpb.Message) error {
 	return nil
 }
 
-func writeProtos(w io.Writer, msgs ...textpb.Message) error {
+// canonicalize applies textpb.Canonicalize to each of msgs, using the options
+// selected by the -order and -sort-by flags.
+func canonicalize(msgs iter.Seq[textpb.Message]) iter.Seq[textpb.Message] {
+	opts := textpb.CanonicalOptions{
+		Order:   splitPaths(*fieldOrder),
+		Dedup:   true,
+		Numbers: true,
+	}
+	for _, pair := range splitPaths(*sortBy) {
+		path, key, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Fatalf("Invalid -sort-by entry %q (want path=key)", pair)
+		}
+		if opts.SortBy == nil {
+			opts.SortBy = make(map[string]string)
+		}
+		opts.SortBy[path] = key
+	}
+	return func(yield func(textpb.Message) bool) {
+		for msg := range msgs {
+			if !yield(textpb.Canonicalize(msg, opts)) {
+				return
+			}
+		}
+	}
+}
+
+// envelope wraps each of msgs in a message recording its source file and its
+// index among the messages from that file.
+func envelope(path string, msgs iter.Seq[textpb.Message]) iter.Seq[textpb.Message] {
+	return func(yield func(textpb.Message) bool) {
+		index := 0
+		for msg := range msgs {
+			env := textpb.Message{
+				{Name: "file", Values: []*textpb.Value{{Type: textpb.String, Text: path}}},
+				{Name: "index", Values: []*textpb.Value{{Type: textpb.Number, Text: strconv.Itoa(index)}}},
+				{Name: "record", Values: []*textpb.Value{{Msg: msg}}},
+			}
+			if !yield(env) {
+				return
+			}
+			index++
+		}
+	}
+}
+
+// streamMessage converts the text-format message from r to JSON on w,
+// without parsing the whole message into memory.
+func streamMessage(w io.Writer, r io.Reader) error {
+	opts := textpb.JSONOptions{}
+	if *doProto3 {
+		opts = textpb.Proto3JSON
+	}
+	jw := textpb.NewJSONWriter(w, opts)
+	jw.SetIndent(*linePrefix, *indent)
+	var h textpb.Handler = jw
+	if *doCamel {
+		h = camelHandler{h}
+	}
+	return textpb.Stream(r, h)
+}
+
+// camelHandler wraps a textpb.Handler to convert field names to camel-case.
+type camelHandler struct{ textpb.Handler }
+
+func (c camelHandler) BeginField(name string) error {
+	return c.Handler.BeginField(textpb.SnakeToCamel(name))
+}
+
+// writeYAML returns a function that writes each message as a YAML document.
+// Each document after the first, across all calls, is preceded by a separator.
+func writeYAML() func(io.Writer, iter.Seq[textpb.Message]) error {
+	var docs int
+	return func(w io.Writer, msgs iter.Seq[textpb.Message]) error {
+		for out := range msgs {
+			if *doCamel {
+				out.ToCamel()
+			}
+			if docs > 0 {
+				fmt.Fprintln(w, "---")
+			}
+			docs++
+			if err := yaml.Encode(w, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeBinary returns a function that writes each message with encode. The
+// messages are concatenated without delimiters, since the binary encodings
+// are self-delimiting.
+func writeBinary(encode func(io.Writer, textpb.Message) error) func(io.Writer, iter.Seq[textpb.Message]) error {
+	return func(w io.Writer, msgs iter.Seq[textpb.Message]) error {
+		for out := range msgs {
+			if *doCamel {
+				out.ToCamel()
+			}
+			if err := encode(w, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeWire returns functions to write messages in wire format, using the
+// message type selected by -schema and -type. With -framing, each message is
+// written as a length-prefixed record; otherwise the messages are catenated.
+func writeWire() (write func(io.Writer, iter.Seq[textpb.Message]) error, flush func(io.Writer) error) {
+	if *framing == "" {
+		return writeBinary(func(w io.Writer, msg textpb.Message) error {
+			data, err := msgType.Encode(msg)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}), func(io.Writer) error { return nil }
+	}
+	var rw *wirepb.RecordWriter
+	write = writeBinary(func(w io.Writer, msg textpb.Message) error {
+		if rw == nil {
+			frame, _ := recordFraming() // checked in main
+			rw = wirepb.NewRecordWriter(w, frame)
+			rw.MaxSize = *maxRecord
+		}
+		data, err := msgType.Encode(msg)
+		if err != nil {
+			return err
+		}
+		return rw.WriteRecord(data)
+	})
+	flush = func(io.Writer) error {
+		if rw == nil {
+			return nil
+		}
+		return rw.Flush()
+	}
+	return write, flush
+}
+
+func writeProtos(w io.Writer, msgs iter.Seq[textpb.Message]) error {
 	cfg := format.Config{
 		Curly:   *doProto2,
-		Compact: *indent == "",
+		Compact: *indent == "" && *lineWidth == 0,
 		Indent:  *indent,
+		Width:   *lineWidth,
+
+		Lists:        *doLists,
+		MessageColon: *msgColon,
+		Separator:    *fieldSep,
 	}
-	for _, out := range msgs {
+	for out := range msgs {
 		if err := cfg.Text(w, out); err != nil {
 			return err
 		}
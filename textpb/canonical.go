@@ -0,0 +1,188 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+// This file adds canonicalization of messages.
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+)
+
+// CanonicalOptions control the behaviour of Canonicalize.
+type CanonicalOptions struct {
+	// Order gives the preferred order of fields. Each entry is either a field
+	// path, as constructed by JoinPath, or a field name, which matches fields
+	// with that name at any level. Fields matched by Order come first in the
+	// order of their entries, with a path taking precedence over a name, and
+	// are followed by the remaining fields in order by name.
+	Order []string
+
+	// SortBy maps the path of a repeated field to the path of a key field
+	// within its values, relative to the value. The values of the field are
+	// sorted by the first value of the key; values lacking the key sort
+	// first. An empty key sorts primitive values by their own text. Keys
+	// that are both numbers are compared numerically, and others as text.
+	SortBy map[string]string
+
+	// If Dedup is true, a value that is equal to an earlier value of the same
+	// field is removed.
+	Dedup bool
+
+	// If Numbers is true, integers are written in decimal, and floating-point
+	// numbers in the shortest form that represents the same value, e.g.,
+	// "0x1F" becomes "31", and "2.50f" becomes "2.5".
+	Numbers bool
+}
+
+// Canonicalize returns a copy of msg in a canonical form, so that equivalent
+// messages produce the same output. The fields of msg are combined, as by
+// Combine, and then ordered, sorted, deduplicated, and normalized according
+// to opts. Comments are discarded.
+func Canonicalize(msg Message, opts CanonicalOptions) Message {
+	return opts.message("", msg.Combine())
+}
+
+func (o CanonicalOptions) message(path string, msg Message) Message {
+	out := make(Message, len(msg))
+	for i, f := range msg {
+		out[i] = o.field(JoinPath(path, f.Name), f)
+	}
+	if len(o.Order) != 0 {
+		// Combine has already sorted the fields by name, so a stable sort by
+		// rank preserves that order among fields of equal rank.
+		slices.SortStableFunc(out, func(a, b *Field) int {
+			return cmp.Compare(o.rank(JoinPath(path, a.Name), a.Name), o.rank(JoinPath(path, b.Name), b.Name))
+		})
+	}
+	return out
+}
+
+// rank returns the position of the field at path in o.Order, or len(o.Order)
+// if it is not listed.
+func (o CanonicalOptions) rank(path, name string) int {
+	if i := slices.Index(o.Order, path); i >= 0 {
+		return i
+	} else if i := slices.Index(o.Order, name); i >= 0 {
+		return i
+	}
+	return len(o.Order)
+}
+
+func (o CanonicalOptions) field(path string, f *Field) *Field {
+	out := &Field{Name: f.Name}
+	seen := make(map[string]bool)
+	for _, v := range f.Values {
+		cv := o.value(path, v)
+		if o.Dedup {
+			key := cv.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		out.Values = append(out.Values, cv)
+	}
+	if key, ok := o.SortBy[path]; ok {
+		slices.SortStableFunc(out.Values, func(a, b *Value) int {
+			return compareKeys(sortKey(a, key), sortKey(b, key))
+		})
+	}
+	return out
+}
+
+func (o CanonicalOptions) value(path string, v *Value) *Value {
+	if v.Msg != nil {
+		return &Value{Msg: o.message(path, v.Msg)}
+	}
+	out := &Value{Type: v.Type, Text: v.Text}
+	if o.Numbers && v.Type == Number {
+		out.Text = canonicalNumber(v)
+	}
+	return out
+}
+
+// canonicalNumber returns the canonical text of the number v.
+func canonicalNumber(v *Value) string {
+	if v.NumberKind().IsInteger() {
+		if z, err := v.BigInt(); err == nil {
+			return z.String()
+		}
+	} else if fp, err := v.Number(); err == nil {
+		switch {
+		case math.IsInf(fp, 1):
+			return "inf"
+		case math.IsInf(fp, -1):
+			return "-inf"
+		case math.IsNaN(fp):
+			return "nan"
+		}
+		return strconv.FormatFloat(fp, 'g', -1, 64)
+	}
+	return v.Text
+}
+
+// sortKey returns the value at the given path within v, or nil if there is
+// none. An empty key selects v itself.
+func sortKey(v *Value, key string) *Value {
+	for _, name := range SplitPath(key) {
+		var next *Value
+		for _, f := range v.Msg {
+			if f.Name == name && len(f.Values) != 0 {
+				next = f.Values[0]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		v = next
+	}
+	return v
+}
+
+// compareKeys orders sort keys: missing keys first, then numbers in numeric
+// order, then other values in order by text.
+func compareKeys(a, b *Value) int {
+	if a == nil || b == nil {
+		return cmp.Compare(boolInt(a != nil), boolInt(b != nil))
+	}
+	if a.Type == Number && b.Type == Number {
+		x, xerr := numberValue(a)
+		y, yerr := numberValue(b)
+		if xerr == nil && yerr == nil {
+			return x.Cmp(y)
+		}
+	}
+	if a.Msg == nil && b.Msg == nil {
+		return cmp.Compare(a.Text, b.Text)
+	}
+	return cmp.Compare(a.String(), b.String())
+}
+
+// numberValue returns the value of the number v as a big.Float, for
+// comparison.
+func numberValue(v *Value) (*big.Float, error) {
+	if v.NumberKind().IsInteger() {
+		z, err := v.BigInt()
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Float).SetInt(z), nil
+	}
+	fp, err := v.Number()
+	if err != nil || math.IsNaN(fp) {
+		return nil, strconv.ErrSyntax
+	}
+	return big.NewFloat(fp), nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		input string
+		opts  CanonicalOptions
+		want  string
+	}{
+		{"", CanonicalOptions{}, ""},
+
+		// Fields are combined and sorted by name.
+		{`c: 1 a: 2 b { z: 1 y: 2 } a: 3`, CanonicalOptions{},
+			`{"a":[2,3],"b":{"y":2,"z":1},"c":1}`},
+
+		// Names in Order apply at every level; paths apply only to the field
+		// they name, and take precedence.
+		{`a: 1 id: 2 m { x: 3 id: 4 name: "n" } name: "q"`,
+			CanonicalOptions{Order: []string{"m.x", "name", "id"}},
+			`{"name":"q","id":2,"a":1,"m":{"x":3,"name":"n","id":4}}`},
+
+		// Repeated messages are sorted by a key, numerically where possible.
+		{`r { k: 10 v: "a" } r { k: 9 v: "b" } r { v: "c" } r { k: 0x0a v: "d" }`,
+			CanonicalOptions{SortBy: map[string]string{"r": "k"}},
+			`{"r":[{"v":"c"},{"k":9,"v":"b"},{"k":10,"v":"a"},{"k":10,"v":"d"}]}`},
+		{`r { s { n: "b" } } r { s { n: "a" } } t: Z t: X t: Y`,
+			CanonicalOptions{SortBy: map[string]string{"r": "s.n", "t": ""}},
+			`{"r":[{"s":{"n":"a"}},{"s":{"n":"b"}}],"t":["X","Y","Z"]}`},
+
+		// Duplicates are removed after normalization.
+		{`a: 1 a: 0x1 a: 2 m { x: 1 } m { x: 1 y: 2 } m { x: 01 }`,
+			CanonicalOptions{Dedup: true, Numbers: true},
+			`{"a":[1,2],"m":[{"x":1},{"x":1,"y":2}]}`},
+		{`a: 1 a: 0x1 a: 1`, CanonicalOptions{Dedup: true}, `{"a":[1,1]}`},
+	}
+	for _, test := range tests {
+		in, err := ParseString(test.input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.input, err)
+		}
+		got := Canonicalize(in, test.opts)
+		if len(got) == 0 && test.want == "" {
+			continue
+		}
+		data, err := got.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON failed: %v", err)
+		}
+		if diff := cmp.Diff(test.want, string(data)); diff != "" {
+			t.Errorf("Canonicalize %q (-want, +got):\n%s", test.input, diff)
+		}
+	}
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"0", "0"},
+		{"0x1F", "31"},
+		{"-0x10", "-16"},
+		{"017", "15"},
+		{"18446744073709551616", "18446744073709551616"},
+		{"0x10000000000000000", "18446744073709551616"},
+		{"2.50", "2.5"},
+		{"2.50f", "2.5"},
+		{"1.0", "1"},
+		{".5e1", "5"},
+		{"1E+30", "1e+30"},
+		{"-Infinity", "-inf"},
+	}
+	for _, test := range tests {
+		in, err := ParseString("v: " + test.input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.input, err)
+		}
+		out := Canonicalize(in, CanonicalOptions{Numbers: true})
+		if got := out[0].Values[0].Text; got != test.want {
+			t.Errorf("Canonicalize %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+// Package cbor encodes textpb.Message values in the Concise Binary Object
+// Representation (CBOR) defined by RFC 8949.
+//
+// The encoding is deterministic in the sense of RFC 8949 Section 4.2: Map
+// keys are sorted by their encoded bytes, and integers, lengths, and
+// floating-point values use their shortest exact forms.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+// Major types defined by RFC 8949 Section 3.1.
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+
+	tagPosBignum = 2
+	tagNegBignum = 3
+)
+
+// Marshal returns the CBOR encoding of msg as a map, after combining fields
+// with the same name. A field with one value maps to that value, and other
+// fields map to arrays. Integers are encoded exactly, using bignums (tags 2
+// and 3) for values that do not fit in 64 bits. Strings that are not valid
+// UTF-8 are encoded as byte strings. Type names are encoded as text in
+// square brackets, as for textpb.MarshalJSON.
+func Marshal(msg textpb.Message) ([]byte, error) {
+	var e encoder
+	if err := e.message(msg.Combine()); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Encode writes the CBOR encoding of msg to w, as described for Marshal.
+func Encode(w io.Writer, msg textpb.Message) error {
+	data, err := Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+// head appends the initial bytes of an item with the given major type and
+// argument.
+func (e *encoder) head(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, major|26), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, major|27), n)
+	}
+}
+
+func (e *encoder) text(s string) {
+	if utf8.ValidString(s) {
+		e.head(majorText, uint64(len(s)))
+	} else {
+		e.head(majorBytes, uint64(len(s)))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) message(msg textpb.Message) error {
+	type entry struct{ key, val []byte }
+	entries := make([]entry, len(msg))
+	for i, f := range msg {
+		var k, v encoder
+		k.text(f.Name)
+		if len(f.Values) != 1 {
+			v.head(majorArray, uint64(len(f.Values)))
+		}
+		for _, val := range f.Values {
+			if err := v.value(val); err != nil {
+				return err
+			}
+		}
+		entries[i] = entry{k.buf, v.buf}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	e.head(majorMap, uint64(len(entries)))
+	for _, ent := range entries {
+		e.buf = append(e.buf, ent.key...)
+		e.buf = append(e.buf, ent.val...)
+	}
+	return nil
+}
+
+func (e *encoder) value(v *textpb.Value) error {
+	if v.Msg != nil {
+		return e.message(v.Msg)
+	}
+	switch v.Type {
+	case textpb.None:
+		e.buf = append(e.buf, majorSimple<<5|22)
+	case textpb.True:
+		e.buf = append(e.buf, majorSimple<<5|21)
+	case textpb.False:
+		e.buf = append(e.buf, majorSimple<<5|20)
+	case textpb.Name, textpb.String:
+		e.text(v.Text)
+	case textpb.TypeName:
+		e.text("[" + v.Text + "]")
+	case textpb.Number:
+		return e.number(v)
+	default:
+		return fmt.Errorf("invalid value type: %v", v.Type)
+	}
+	return nil
+}
+
+func (e *encoder) number(v *textpb.Value) error {
+	if !v.NumberKind().IsInteger() {
+		fp, err := v.Number()
+		if err != nil {
+			return fmt.Errorf("inconvertible number %q", v.Text)
+		}
+		e.float(fp)
+		return nil
+	}
+	if z, err := v.Fixed(); err == nil && z < 0 {
+		e.head(majorNegint, uint64(-1-z))
+	} else if u, err := v.Uint(); err == nil {
+		e.head(majorUint, u)
+	} else if b, err := v.BigInt(); err == nil {
+		e.bigint(b)
+	} else {
+		return fmt.Errorf("inconvertible number %q", v.Text)
+	}
+	return nil
+}
+
+// bigint encodes an integer that does not fit in 64 bits. A negative value n
+// is encoded by the magnitude of -1-n, following RFC 8949 Section 3.1.
+func (e *encoder) bigint(z *big.Int) {
+	major, tag := byte(majorUint), uint64(tagPosBignum)
+	if z.Sign() < 0 {
+		z = new(big.Int).Sub(big.NewInt(-1), z)
+		major, tag = majorNegint, tagNegBignum
+	}
+	if z.IsUint64() {
+		e.head(major, z.Uint64())
+		return
+	}
+	mag := z.Bytes()
+	e.head(majorTag, tag)
+	e.head(majorBytes, uint64(len(mag)))
+	e.buf = append(e.buf, mag...)
+}
+
+// float encodes fp in the shortest of the half, single, and double precision
+// formats that represents it exactly.
+func (e *encoder) float(fp float64) {
+	if math.IsNaN(fp) {
+		e.buf = append(e.buf, majorSimple<<5|25, 0x7e, 0x00)
+		return
+	}
+	f32 := float32(fp)
+	if float64(f32) != fp {
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, majorSimple<<5|27), math.Float64bits(fp))
+	} else if h, ok := toHalf(f32); ok {
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, majorSimple<<5|25), h)
+	} else {
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, majorSimple<<5|26), math.Float32bits(f32))
+	}
+}
+
+// toHalf converts f to IEEE 754 half precision, and reports whether the
+// conversion is exact.
+func toHalf(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff == 0: // zero
+		return sign, true
+	case exp == 128: // infinity (NaN is handled by the caller)
+		return sign | 0x7c00, mant == 0
+	case exp >= -14 && exp <= 15: // normal
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14: // subnormal
+		full := mant | 0x800000 // include the implicit leading bit
+		shift := uint(-exp - 1)
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
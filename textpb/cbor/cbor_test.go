@@ -0,0 +1,115 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package cbor_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/creachadair/pson/textpb"
+	"github.com/creachadair/pson/textpb/cbor"
+)
+
+func mustMarshal(t *testing.T, s string) string {
+	t.Helper()
+	msg, err := textpb.ParseString(s)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", s, err)
+	}
+	data, err := cbor.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal %q: unexpected error: %v", s, err)
+	}
+	return hex.EncodeToString(data)
+}
+
+// The expected encodings of scalar values are from RFC 8949 Appendix A.
+func TestValues(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"0", "00"},
+		{"23", "17"},
+		{"24", "1818"},
+		{"1000", "1903e8"},
+		{"0x3e8", "1903e8"},
+		{"1000000000000", "1b000000e8d4a51000"},
+		{"18446744073709551615", "1bffffffffffffffff"},
+		{"18446744073709551616", "c249010000000000000000"},
+		{"-1", "20"},
+		{"-1000", "3903e7"},
+		{"-18446744073709551616", "3bffffffffffffffff"},
+		{"-18446744073709551617", "c349010000000000000000"},
+		{"0.0", "f90000"},
+		{"-0.0", "f98000"},
+		{"1.5", "f93e00"},
+		{"65504.0", "f97bff"},
+		{"100000.0", "fa47c35000"},
+		{"1.1", "fb3ff199999999999a"},
+		{"5.960464477539063e-8", "f90001"},
+		{"0.00006103515625", "f90400"},
+		{"-4.0", "f9c400"},
+		{"1.0e+300", "fb7e37e43c8800759c"},
+		{"-inf", "f9fc00"},
+		{"-Infinity", "f9fc00"},
+		{"true", "f5"},
+		{"false", "f4"},
+		{`""`, "60"},
+		{`"IETF"`, "6449455446"},
+		{`"ü"`, "62c3bc"},
+		{"ENUM", "64454e554d"},
+		{"inf", "63696e66"}, // a name, as for MarshalJSON
+	}
+	for _, test := range tests {
+		// The value is wrapped as {"v": value}.
+		want := "a16176" + test.want
+		if got := mustMarshal(t, "v: "+test.value); got != want {
+			t.Errorf("Marshal %q: got %s, want %s", test.value, got, want)
+		}
+	}
+
+	// A type name value, which the text parser does not produce, is written
+	// as a string in brackets.
+	msg := textpb.Message{{Name: "v", Values: []*textpb.Value{{Type: textpb.TypeName, Text: "a.B"}}}}
+	if data, err := cbor.Marshal(msg); err != nil {
+		t.Errorf("Marshal %v: unexpected error: %v", msg, err)
+	} else if got, want := hex.EncodeToString(data), "a16176655b612e425d"; got != want {
+		t.Errorf("Marshal %v: got %s, want %s", msg, got, want)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", "a0"},
+
+		// Keys are sorted by encoded bytes, so shorter keys come first.
+		{"bb: 1 a: 2 c: 3", "a3616102616303626262" + "01"},
+
+		// Repeated fields are combined into arrays.
+		{"a: 1 b {} a: 2", "a2616182010261" + "62a0"},
+		{"a { x: 1 } a { y: 2 }", "a1616182a1617801a1617902"},
+		{"[p.Ext] { q: 1 }", "a165702e457874a1617101"},
+	}
+	for _, test := range tests {
+		if got := mustMarshal(t, test.input); got != test.want {
+			t.Errorf("Marshal %q: got %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	msg := textpb.Message{{
+		Name:   "s",
+		Values: []*textpb.Value{{Type: textpb.String, Text: "\xff"}},
+	}}
+	want := []byte{0xa1, 0x61, 's', 0x41, 0xff} // byte string, not text
+	got, err := cbor.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: unexpected error: %v", err)
+	} else if !bytes.Equal(got, want) {
+		t.Errorf("Marshal: got %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package format
+
+// This file implements a small document algebra for layout, in the style of
+// Wadler's "A prettier printer". A document is built from text, line breaks,
+// nesting, and groups. When a group fits in the remaining width, its line
+// breaks are rendered flat; otherwise they become newlines.
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A doc is one of the document types below.
+type doc any
+
+// text is literal text, which must not contain newlines.
+type text string
+
+// line is a line break, rendered as a space (or nothing, if soft) when its
+// group is flat. A hard line always breaks, and forces its groups to break.
+type line struct{ soft, hard bool }
+
+// breakParent renders nothing, but forces its enclosing groups to break.
+type breakParent struct{}
+
+// nest increases the indentation of line breaks in its contents by one level.
+type nest struct{ d doc }
+
+// group marks a document whose line breaks are rendered flat if it fits.
+type group struct {
+	d    doc
+	hard bool // whether d contains a hard line, so it can never be flat
+}
+
+// cat is the concatenation of its elements.
+type cat []doc
+
+var (
+	hardline = line{hard: true}
+	softline = line{soft: true}
+)
+
+func newGroup(d doc) group { return group{d: d, hard: isHard(d)} }
+
+// isHard reports whether d contains a hard line break outside a nested group.
+// Nested groups record their own status when they are constructed.
+func isHard(d doc) bool {
+	switch t := d.(type) {
+	case line:
+		return t.hard
+	case breakParent:
+		return true
+	case nest:
+		return isHard(t.d)
+	case group:
+		return t.hard
+	case cat:
+		for _, elt := range t {
+			if isHard(elt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// join concatenates docs separated by sep.
+func join(docs []doc, sep doc) cat {
+	var out cat
+	for i, d := range docs {
+		if i > 0 {
+			out = append(out, sep)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// A layout renders documents within a fixed width. A width of zero or less
+// means that no group fits, so every group breaks.
+type layout struct {
+	width  int
+	indent string // the indentation for each level of nesting
+}
+
+// An item is a document awaiting rendering, with its indentation level and
+// whether its group is flat.
+type item struct {
+	level int
+	flat  bool
+	d     doc
+}
+
+// render returns the text of d. If flat is true, d is rendered as if its
+// enclosing group fits.
+func (l layout) render(d doc, flat bool) string {
+	var buf strings.Builder
+	col := 0
+	stack := []item{{0, flat, d}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch t := it.d.(type) {
+		case text:
+			buf.WriteString(string(t))
+			col += utf8.RuneCountInString(string(t))
+		case line:
+			if it.flat && !t.hard {
+				if !t.soft {
+					buf.WriteByte(' ')
+					col++
+				}
+			} else {
+				ind := strings.Repeat(l.indent, it.level)
+				buf.WriteString("\n" + ind)
+				col = utf8.RuneCountInString(ind)
+			}
+		case nest:
+			stack = append(stack, item{it.level + 1, it.flat, t.d})
+		case group:
+			fits := it.flat || (!t.hard && l.fits(l.width-col, item{it.level, true, t.d}, stack))
+			stack = append(stack, item{it.level, fits, t.d})
+		case cat:
+			for i := len(t) - 1; i >= 0; i-- {
+				stack = append(stack, item{it.level, it.flat, t[i]})
+			}
+		}
+	}
+	return buf.String()
+}
+
+// fits reports whether first, rendered flat, and the remaining documents up
+// to the next line break fit within rem columns.
+func (l layout) fits(rem int, first item, rest []item) bool {
+	if l.width <= 0 {
+		return false
+	}
+	work := []item{first}
+	for rem >= 0 {
+		var it item
+		if n := len(work); n > 0 {
+			it, work = work[n-1], work[:n-1]
+		} else if n := len(rest); n > 0 {
+			it, rest = rest[n-1], rest[:n-1]
+		} else {
+			break
+		}
+
+		switch t := it.d.(type) {
+		case text:
+			rem -= utf8.RuneCountInString(string(t))
+		case line:
+			if !it.flat || t.hard {
+				return true
+			} else if !t.soft {
+				rem--
+			}
+		case nest:
+			work = append(work, item{it.level + 1, it.flat, t.d})
+		case group:
+			work = append(work, item{it.level, it.flat && !t.hard, t.d})
+		case cat:
+			for i := len(t) - 1; i >= 0; i-- {
+				work = append(work, item{it.level, it.flat, t[i]})
+			}
+		}
+	}
+	return rem >= 0
+}
@@ -6,19 +6,22 @@ package format
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/creachadair/pson/textpb"
 )
 
+var isName = regexp.MustCompile(`^([_a-zA-Z][_a-zA-Z0-9]*|[0-9]+)$`)
+
 var (
 	// Curly
 	left  = map[bool]string{false: "<", true: "{"}
 	right = map[bool]string{false: ">", true: "}"}
 	// Compact
 	space = map[bool]string{false: " ", true: ""}
-	next  = map[bool]string{false: "\n", true: " "}
-	end   = map[bool]string{false: "\n", true: ""}
 )
 
 // A Config captures settings for rendering messages in text format.
@@ -26,84 +29,241 @@ type Config struct {
 	Compact bool   // If true, omit vertical whitespace.
 	Curly   bool   // If true, use {} for grouping rather than <>.
 	Indent  string // Use this string for each level of indentation.
+
+	// If Width > 0, a sub-message or the values of a repeated scalar field
+	// are written on one line if they fit within this many columns, and are
+	// otherwise broken across lines. If Width == 0, each field is written on
+	// a line of its own. Width is ignored if Compact is true.
+	Width int
+
+	// If Lists is true, a field with more than one value is written in list
+	// syntax, "name: [a, b]", rather than as a separate field for each value.
+	// A field with no values is written as "name: []". The message should be
+	// combined first, so that the values of each field are collected.
+	Lists bool
+
+	// If MessageColon is true, a colon is written between the name and the
+	// value of a message field, "name: {...}"; otherwise "name {...}".
+	MessageColon bool
+
+	// Separator, if set, is written between adjacent fields of a message. It
+	// must be "", ",", or ";".
+	Separator string
 }
 
 // Text renders the specified message to w in text format.
-func (c Config) Text(w io.Writer, msg textpb.Message) error { return c.textMessage(w, msg, 0) }
+func (c Config) Text(w io.Writer, msg textpb.Message) error {
+	switch c.Separator {
+	case "", ",", ";":
+	default:
+		return fmt.Errorf("invalid separator %q", c.Separator)
+	}
+	l := layout{width: c.Width, indent: c.Indent}
+	if l.indent == "" {
+		l.indent = "  "
+	}
+	_, err := io.WriteString(w, l.render(c.message(msg), c.Compact))
+	return err
+}
+
+// message returns a document for the fields of msg, separated by lines.
+// If c.Width > 0, adjacent scalar fields with the same name are grouped.
+func (c Config) message(msg textpb.Message) doc {
+	var fields []doc
+	for i := 0; i < len(msg); {
+		j := i + 1
+		if c.Width > 0 && c.isRun(msg[i]) {
+			for j < len(msg) && msg[j].Name == msg[i].Name && c.isRun(msg[j]) {
+				j++
+			}
+		}
+		run := make([]doc, j-i)
+		for k, field := range msg[i:j] {
+			run[k] = c.field(field, i+k < len(msg)-1)
+		}
+		if len(run) == 1 {
+			fields = append(fields, run[0])
+		} else {
+			fields = append(fields, newGroup(join(run, line{})))
+		}
+		i = j
+	}
+	return join(fields, line{})
+}
+
+// isRun reports whether field may be grouped with adjacent fields of the
+// same name, namely, it is written as a single scalar value.
+func (c Config) isRun(field *textpb.Field) bool {
+	return isScalar(field) && (!c.Lists || len(field.Values) == 1)
+}
 
-func (c Config) textMessage(w io.Writer, msg textpb.Message, level int) error {
-	for i, field := range msg {
-		if err := c.textField(w, field, level, i < len(msg)-1); err != nil {
-			return err
+// isScalar reports whether field has only primitive values.
+func isScalar(field *textpb.Field) bool {
+	for _, value := range field.Values {
+		if value.Msg != nil {
+			return false
 		}
 	}
-	return nil
+	return len(field.Values) != 0
 }
 
-func (c Config) textField(w io.Writer, field *textpb.Field, level int, sep bool) error {
-	if len(field.Values) == 0 { // empty: treat as empty repeated field
-		return fp(w, c.indent(level), field.Name, c.space(), c.left(), c.right())
+// field returns a document for field, followed by the separator if sep is
+// true.
+func (c Config) field(field *textpb.Field, sep bool) doc {
+	var out cat
+	if !c.Compact {
+		for _, txt := range field.Comments {
+			out = append(out, text("#"+txt), hardline)
+		}
 	}
-	for i, value := range field.Values {
-		if err := c.textValue(w, field.Name, value, level, i < len(field.Values)-1); err != nil {
-			return err
+	name := fieldName(field.Name)
+	switch {
+	case len(field.Values) == 0 && c.Lists:
+		out = append(out, text(name+":"+c.space()+"[]"))
+	case len(field.Values) == 0: // empty: treat as empty repeated field
+		out = append(out, text(name+c.space()+c.left()+c.right()))
+	case len(field.Values) > 1 && c.Lists:
+		out = append(out, c.list(name, field))
+	default:
+		values := make([]doc, len(field.Values))
+		for i, value := range field.Values {
+			values[i] = cat{c.prefix(name, value), c.value(value)}
+		}
+		if last := field.Values[len(field.Values)-1]; len(field.Inner) != 0 && !c.Compact &&
+			last.Msg != nil && len(last.Msg) == 0 {
+			values[len(values)-1] = cat{c.prefix(name, last), c.inner(field.Inner)}
+		}
+		between := cat{text(c.Separator), line{}}
+		if c.Width > 0 && len(values) > 1 && isScalar(field) {
+			out = append(out, newGroup(join(values, between)))
+		} else {
+			out = append(out, join(values, between))
+		}
+	}
+	if sep {
+		out = append(out, text(c.Separator))
+	}
+
+	if !c.Compact {
+		if field.LineComment != "" {
+			out = append(out, text(" #"+field.LineComment), breakParent{})
+		}
+		for _, txt := range field.Trailing {
+			out = append(out, hardline, text("#"+txt))
 		}
 	}
-	return c.next(w, sep)
+	return out
 }
 
-func (c Config) textValue(w io.Writer, name string, value *textpb.Value, level int, sep bool) error {
-	if err := fp(w, c.indent(level), name); err != nil {
-		return err
+// list returns a document for the values of field in list syntax.
+func (c Config) list(name string, field *textpb.Field) doc {
+	values := make([]doc, len(field.Values))
+	for i, value := range field.Values {
+		values[i] = c.value(value)
+	}
+	prefix := c.prefix(name, field.Values[0])
+
+	// Without a width, a list of scalars stays on one line.
+	if c.Width <= 0 && isScalar(field) {
+		return cat{prefix, text("["), join(values, text(","+c.space())), text("]")}
+	}
+	return cat{
+		prefix,
+		newGroup(cat{
+			text("["),
+			nest{cat{softline, join(values, cat{text(","), line{soft: c.Compact}})}},
+			softline,
+			text("]"),
+		}),
+	}
+}
+
+// inner returns a document for an empty message value containing only the
+// given comments.
+func (c Config) inner(comments []string) doc {
+	lines := make([]doc, len(comments))
+	for i, txt := range comments {
+		lines[i] = text("#" + txt)
 	}
+	return cat{text(c.left()), nest{cat{hardline, join(lines, hardline)}}, hardline, text(c.right())}
+}
+
+// prefix returns the text that precedes a value of the named field.
+func (c Config) prefix(name string, value *textpb.Value) doc {
 	if value.Msg == nil {
-		if err := fp(w, ":", c.space(), tokenText(value)); err != nil {
-			return err
-		}
-		return c.next(w, sep)
-	}
-	if len(value.Msg) == 0 {
-		return fp(w, " ", c.left(), c.right())
-	} else if err := fp(w, " ", c.left(), c.first()); err != nil {
-		return err
-	} else if err := c.textMessage(w, value.Msg, level+1); err != nil {
-		return err
-	} else if err := fp(w, c.last(), c.indent(level), c.right()); err != nil {
-		return err
-	}
-	return c.next(w, sep)
+		return text(name + ":" + c.space())
+	} else if c.MessageColon {
+		return text(name + ": ")
+	}
+	return text(name + " ")
 }
 
-func (c Config) indent(level int) string {
-	if c.Compact {
-		return ""
-	} else if c.Indent == "" {
-		return strings.Repeat("  ", level)
+func (c Config) value(value *textpb.Value) doc {
+	if value.Msg == nil {
+		return text(tokenText(value))
+	} else if len(value.Msg) == 0 {
+		return text(c.left() + c.right())
 	}
-	return strings.Repeat(c.Indent, level)
+	inner := line{soft: c.Compact}
+	return newGroup(cat{
+		text(c.left()),
+		nest{cat{inner, c.message(value.Msg)}},
+		inner,
+		text(c.right()),
+	})
+}
+
+// fieldName returns the text of a field name, enclosing extension and type
+// names in square brackets. Field numbers, as produced by raw decoding, are
+// written without brackets.
+func fieldName(name string) string {
+	if isName.MatchString(name) {
+		return name
+	}
+	return "[" + name + "]"
 }
 
 func tokenText(v *textpb.Value) string {
-	if v.Type == textpb.String {
-		return `"` + strings.Replace(v.Text, `"`, `\"`, -1) + `"`
+	switch v.Type {
+	case textpb.String:
+		return quote(v.Text)
+	case textpb.TypeName:
+		return "[" + v.Text + "]"
 	}
 	return v.Text
 }
 
-func (c Config) left() string  { return left[c.Curly] }
-func (c Config) right() string { return right[c.Curly] }
-func (c Config) space() string { return space[c.Compact] }
-func (c Config) first() string { return end[c.Compact] }
-func (c Config) last() string  { return end[c.Compact] }
-
-func (c Config) next(w io.Writer, want bool) error {
-	if want {
-		return fp(w, next[c.Compact])
+// quote returns s as a double-quoted string literal. Printable characters
+// other than quotes and backslashes are written as-is; other bytes are escaped
+// in octal, unless they have a shorter C escape.
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == utf8.RuneError && n == 1, !unicode.IsPrint(r):
+			for _, b := range []byte(s[i : i+n]) {
+				fmt.Fprintf(&buf, `\%03o`, b)
+			}
+		default:
+			buf.WriteString(s[i : i+n])
+		}
+		i += n
 	}
-	return nil
+	buf.WriteByte('"')
+	return buf.String()
 }
 
-func fp(w io.Writer, args ...any) error {
-	_, err := fmt.Fprint(w, args...)
-	return err
-}
+func (c Config) left() string  { return left[c.Curly] }
+func (c Config) right() string { return right[c.Curly] }
+func (c Config) space() string { return space[c.Compact] }
@@ -4,6 +4,7 @@ package format
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -11,10 +12,10 @@ import (
 )
 
 var configs = []Config{
-	{false, false, "@"},
-	{false, true, "@"},
-	{true, false, "@"},
-	{true, true, "@"},
+	{Indent: "@"},
+	{Curly: true, Indent: "@"},
+	{Compact: true, Indent: "@"},
+	{Compact: true, Curly: true, Indent: "@"},
 }
 
 var sub = strings.NewReplacer("*", "\n")
@@ -44,6 +45,11 @@ func TestTextFormatting(t *testing.T) {
 			ans(`a <*@b <*@@c: 1*@@c: 2*@@c: 3*@>*@d <*@@e <*@@@f: 0x3f*@@>*@>*>`, `a <b <c:1 c:2 c:3> d <e <f:0x3f>>>`)},
 		{`a:FOO a:BAR a:BAZ`,
 			ans(`a: FOO*a: BAR*a: BAZ`, `a:FOO a:BAR a:BAZ`)},
+		{`a{} a{}`, ans(`a <>*a <>`, `a <> a <>`)},
+		{`[p.q] { [x/y.Z] { v: [U] } }`,
+			ans(`[p.q] <*@[x/y.Z] <*@@v: U*@>*>`, `[p.q] <[x/y.Z] <v:U>>`)},
+		{`s: 'it\'s "\\" \n\t\001\377 ü'`,
+			ans(`s: "it's \"\\\" \n\t\001\377 ü"`, `s:"it's \"\\\" \n\t\001\377 ü"`)},
 	}
 	for _, test := range tests {
 		msg, err := textpb.ParseString(test.input)
@@ -63,4 +69,178 @@ func TestTextFormatting(t *testing.T) {
 			}
 		}
 	}
+
+	// A type name value, which the parser does not produce, is written in
+	// brackets.
+	msg := textpb.Message{{Name: "v", Values: []*textpb.Value{{Type: textpb.TypeName, Text: "t.U"}}}}
+	var buf bytes.Buffer
+	if err := (Config{}).Text(&buf, msg); err != nil {
+		t.Errorf("Text %v: unexpected error: %v", msg, err)
+	} else if got, want := buf.String(), "v: [t.U]"; got != want {
+		t.Errorf("Text %v: got «%s», want «%s»", msg, got, want)
+	}
+}
+
+func TestComments(t *testing.T) {
+	const input = `# head
+a: 1 # line a
+b { # in b
+  c: 2
+  # end of b
+}
+d {}  # line d
+e { # in e
+}
+f: [1, # one
+  2] # two
+# tail`
+	const want = `# head
+a: 1 # line a
+b {
+  # in b
+  c: 2
+  # end of b
+}
+d {} # line d
+e {
+  # in e
+}
+f: 1 # one
+f: 2 # two
+# tail`
+	msg, err := textpb.ParseString(input)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", input, err)
+	}
+	cfg := Config{Curly: true, Indent: "  "}
+	var buf bytes.Buffer
+	if err := cfg.Text(&buf, msg); err != nil {
+		t.Fatalf("Text: unexpected error: %v", err)
+	} else if got := buf.String(); got != want {
+		t.Errorf("Text: got\n«%s»\nwant\n«%s»", got, want)
+	}
+
+	// Compact output omits comments.
+	buf.Reset()
+	cfg.Compact = true
+	if err := cfg.Text(&buf, msg); err != nil {
+		t.Fatalf("Text: unexpected error: %v", err)
+	} else if got, want := buf.String(), `a:1 b {c:2} d {} e {} f:1 f:2`; got != want {
+		t.Errorf("Text: got «%s», want «%s»", got, want)
+	}
+}
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		width int
+		want  string
+	}{
+		{`a: 1 b: 2`, 20, "a: 1\nb: 2"},
+		{`a { b: 1 c: 2 }`, 20, "a { b: 1 c: 2 }"},
+		{`a { b: 1 c: 2 }`, 14, "a {\n  b: 1\n  c: 2\n}"},
+		{`a { b: 1 c: 2 }`, 15, "a { b: 1 c: 2 }"},
+
+		// Inner groups may stay flat when the outer group breaks.
+		{`a { b { c: 1 } d { e: "long string" } }`, 24,
+			"a {\n  b { c: 1 }\n  d { e: \"long string\" }\n}"},
+		{`a { b { c: 1 } d { e: "long string" } }`, 20,
+			"a {\n  b { c: 1 }\n  d {\n    e: \"long string\"\n  }\n}"},
+
+		// Repeated scalars are kept together when they fit.
+		{`r: 1 r: 2 r: 3 s: "x"`, 20, "r: 1 r: 2 r: 3\ns: \"x\""},
+		{`r: 1 r: 2 r: 3 s: "x"`, 10, "r: 1\nr: 2\nr: 3\ns: \"x\""},
+		{`m { r: 1 r: 2 } m {}`, 20, "m { r: 1 r: 2 }\nm {}"},
+		{`r: 1 s: 2 r: 3`, 40, "r: 1\ns: 2\nr: 3"},
+
+		// Text following a group counts against its width.
+		{"a { b: 1 } # note", 12, "a {\n  b: 1\n} # note"},
+
+		// Comments force their enclosing groups to break.
+		{"a { b: 1 # note\n }", 40, "a {\n  b: 1 # note\n}"},
+		{"a {\n # lead\n b: 1 }", 40, "a {\n  # lead\n  b: 1\n}"},
+	}
+	for _, test := range tests {
+		msg, err := textpb.ParseString(test.input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.input, err)
+		}
+		cfg := Config{Curly: true, Width: test.width}
+		var buf bytes.Buffer
+		if err := cfg.Text(&buf, msg); err != nil {
+			t.Errorf("Text %#q: unexpected error: %v", test.input, err)
+		} else if got := buf.String(); got != test.want {
+			t.Errorf("Text %#q width %d: got\n«%s»\nwant\n«%s»", test.input, test.width, got, test.want)
+		}
+	}
+
+	// The values of a combined repeated field are grouped the same way.
+	msg, err := textpb.ParseString(`r: 1 s: 2 r: 3`)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parsing failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := (Config{Width: 20}).Text(&buf, msg.Combine()); err != nil {
+		t.Errorf("Text: unexpected error: %v", err)
+	} else if got, want := buf.String(), "r: 1 r: 3\ns: 2"; got != want {
+		t.Errorf("Text: got\n«%s»\nwant\n«%s»", got, want)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	const input = `a: 1 a: 2 b { c: "x" } b {} e { f: 3 } g: X`
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Curly: true, Lists: true},
+			"a: [1, 2]\nb [\n  {\n    c: \"x\"\n  },\n  {}\n]\ne {\n  f: 3\n}\ng: X"},
+		{Config{Curly: true, Lists: true, Width: 40},
+			"a: [1, 2]\nb [{ c: \"x\" }, {}]\ne { f: 3 }\ng: X"},
+		{Config{Curly: true, Lists: true, Width: 14},
+			"a: [1, 2]\nb [\n  { c: \"x\" },\n  {}\n]\ne { f: 3 }\ng: X"},
+		{Config{Compact: true, Lists: true, MessageColon: true},
+			`a:[1,2] b: [<c:"x">,<>] e: <f:3> g:X`},
+		{Config{Curly: true, MessageColon: true, Separator: ","},
+			"a: 1,\na: 2,\nb: {\n  c: \"x\"\n},\nb: {},\ne: {\n  f: 3\n},\ng: X"},
+		{Config{Compact: true, Curly: true, Separator: ";"},
+			`a:1; a:2; b {c:"x"}; b {}; e {f:3}; g:X`},
+		{Config{Curly: true, Width: 80, Separator: ","},
+			"a: 1, a: 2,\nb { c: \"x\" },\nb {},\ne { f: 3 },\ng: X"},
+	}
+	msg, err := textpb.ParseString(input)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", input, err)
+	}
+	msg = msg.Combine()
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.cfg.Text(&buf, msg); err != nil {
+			t.Errorf("Text %+v: unexpected error: %v", test.cfg, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("Text %+v: got\n«%s»\nwant\n«%s»", test.cfg, got, test.want)
+		}
+
+		// The output must parse back to the same message.
+		back, err := textpb.ParseString(buf.String())
+		if err != nil {
+			t.Errorf("Parsing output of %+v failed: %v", test.cfg, err)
+		} else if got, want := fmt.Sprint(back.Combine()), fmt.Sprint(msg.Combine()); got != want {
+			t.Errorf("Round trip %+v: got %s, want %s", test.cfg, got, want)
+		}
+	}
+
+	// A field with no values is an empty list.
+	var buf bytes.Buffer
+	if err := (Config{Lists: true}).Text(&buf, textpb.Message{{Name: "d"}}); err != nil {
+		t.Errorf("Text: unexpected error: %v", err)
+	} else if got, want := buf.String(), "d: []"; got != want {
+		t.Errorf("Text: got «%s», want «%s»", got, want)
+	}
+
+	if err := (Config{Separator: "|"}).Text(&bytes.Buffer{}, msg); err == nil {
+		t.Error("Text with invalid separator: got nil, want error")
+	}
 }
@@ -4,9 +4,13 @@ package textpb
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"math"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // MarshalJSON implements the json.Marshaler interface.  Conversion to JSON is
@@ -22,27 +26,119 @@ import (
 //
 // ∙ Booleans are represented by "true" and "false".
 //
-// ∙ Numbers are copied literally.
+// ∙ Numbers are copied literally. Integers are written in decimal, with no
+// loss of precision regardless of their magnitude.
 //
 // ∙ Field names and enumerators are encoded as strings.
 //
 // Note that we don't really know which fields are declared as repeated; we
 // assume a field is repeated if it has 0 or > 1 values.
-func (m Message) MarshalJSON() ([]byte, error) {
+func (m Message) MarshalJSON() ([]byte, error) { return JSONOptions{}.Marshal(m) }
+
+// JSONOptions control the encoding of messages as JSON. The zero value
+// encodes messages as described for MarshalJSON.
+type JSONOptions struct {
+	// Encode integers that do not fit in 32 bits as quoted strings, as the
+	// proto3 mapping does for values of 64-bit integer types.
+	Int64AsString bool
+
+	// Convert field names to lowerCamelCase, following the rules protoc uses
+	// to generate the default json_name of a field.
+	CamelCase bool
+
+	// Render a field whose name is a type URL, as in an expanded Any message,
+	// as an "@type" key followed by the fields of its message value:
+	//
+	//	any { [type.googleapis.com/pkg.Msg] { x: 1 } }
+	//	{"any":{"@type":"type.googleapis.com/pkg.Msg","x":1}}
+	//
+	// A message whose only fields are a type_url string holding a type URL
+	// and an optional value string, as for an Any message in wire form, is
+	// rendered as an "@type" key and a "value" key whose value is the base64
+	// encoding of the bytes:
+	//
+	//	any { type_url: "type.googleapis.com/pkg.Msg" value: "\010\001" }
+	//	{"any":{"@type":"type.googleapis.com/pkg.Msg","value":"CAE="}}
+	//
+	// ParseJSON reads both forms back, except that a wire-form message with
+	// no value field is read as an expanded Any with no fields. Extension
+	// field names are enclosed in square brackets. A JSONWriter handles only
+	// the expanded form.
+	ExpandAny bool
+
+	// Encode infinities and NaN as the strings "Infinity", "-Infinity", and
+	// "NaN". Otherwise such values are encoded as strings containing their
+	// literal text.
+	SpecialFloats bool
+}
+
+// Proto3JSON is a set of options that approximate the proto3 canonical JSON
+// mapping, as far as that is possible without knowing the message schema.
+var Proto3JSON = JSONOptions{
+	Int64AsString: true,
+	CamelCase:     true,
+	ExpandAny:     true,
+	SpecialFloats: true,
+}
+
+// Marshal encodes m as JSON according to the options in o.
+func (o JSONOptions) Marshal(m Message) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := m.marshalJSON(&buf); err != nil {
+	if err := o.marshalMessage(&buf, m); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func (m Message) marshalJSON(buf *bytes.Buffer) error {
+// jsonBuffer is the interface to the output buffer used by the JSON encoder.
+// It is satisfied by *bytes.Buffer and *bufio.Writer.
+type jsonBuffer interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+func (o JSONOptions) marshalMessage(buf jsonBuffer, m Message) error {
 	buf.WriteByte('{')
-	for i, f := range m {
-		if i > 0 {
+	if err := o.marshalFields(buf, m, true); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// marshalFields encodes the fields of m as the members of an object, without
+// the enclosing braces. If first is false, a comma precedes the first field.
+func (o JSONOptions) marshalFields(buf jsonBuffer, m Message, first bool) error {
+	if url, value, ok := anyFields(m); ok && o.ExpandAny {
+		if !first {
 			buf.WriteByte(',')
 		}
-		fmt.Fprintf(buf, "%q:", f.Name)
+		buf.WriteString(`"@type":`)
+		writeJSONString(buf, url)
+		if value != nil {
+			buf.WriteString(`,"value":`)
+			writeJSONString(buf, base64.StdEncoding.EncodeToString([]byte(value.Text)))
+		}
+		return nil
+	}
+	for _, f := range m {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		if o.ExpandAny && isTypeURL(f.Name) && len(f.Values) == 1 && f.Values[0].Msg != nil {
+			buf.WriteString(`"@type":`)
+			writeJSONString(buf, f.Name)
+			if err := o.marshalFields(buf, f.Values[0].Msg, false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		writeJSONString(buf, o.fieldName(f.Name))
+		buf.WriteByte(':')
 		if len(f.Values) != 1 {
 			buf.WriteByte('[')
 		}
@@ -50,7 +146,7 @@ func (m Message) marshalJSON(buf *bytes.Buffer) error {
 			if j > 0 {
 				buf.WriteByte(',')
 			}
-			if err := v.marshalJSON(buf); err != nil {
+			if err := o.marshalValue(buf, v); err != nil {
 				return err
 			}
 		}
@@ -58,28 +154,45 @@ func (m Message) marshalJSON(buf *bytes.Buffer) error {
 			buf.WriteByte(']')
 		}
 	}
-	buf.WriteByte('}')
 	return nil
 }
 
-func (v *Value) marshalJSON(buf *bytes.Buffer) error {
+func (o JSONOptions) marshalValue(buf jsonBuffer, v *Value) error {
 	if v.Msg != nil {
-		return v.Msg.marshalJSON(buf)
+		return o.marshalMessage(buf, v.Msg)
 	}
 	switch v.Type {
 	case None:
 		buf.WriteString("null")
-	case Name, String:
-		buf.WriteString(strconv.Quote(v.Text))
+	case Name:
+		if o.SpecialFloats {
+			if fp, ok := specialFloat(v.Text); ok {
+				writeJSONString(buf, floatName(fp))
+				break
+			}
+		}
+		writeJSONString(buf, v.Text)
+	case String:
+		writeJSONString(buf, v.Text)
 	case TypeName:
-		buf.WriteString(strconv.Quote("[" + v.Text + "]"))
+		writeJSONString(buf, "["+v.Text+"]")
 	case True, False:
 		buf.WriteString(v.Text)
 	case Number:
-		if fix, err := v.Fixed(); err == nil {
-			buf.WriteString(strconv.FormatInt(fix, 10))
+		if z, ok := v.integer(); ok {
+			s := fmt.Sprint(z)
+			if o.Int64AsString && !fits32(z) {
+				s = strconv.Quote(s)
+			}
+			buf.WriteString(s)
 		} else if fp, err := v.Number(); err == nil {
-			buf.WriteString(strconv.FormatFloat(fp, 'g', -1, 64))
+			if !math.IsInf(fp, 0) && !math.IsNaN(fp) {
+				buf.WriteString(strconv.FormatFloat(fp, 'g', -1, 64))
+			} else if o.SpecialFloats {
+				writeJSONString(buf, floatName(fp))
+			} else {
+				writeJSONString(buf, v.Text)
+			}
 		} else {
 			return fmt.Errorf("inconvertible number %q", v.Text)
 		}
@@ -89,6 +202,143 @@ func (v *Value) marshalJSON(buf *bytes.Buffer) error {
 	return nil
 }
 
+// anyFields reports whether m has the form of an Any message in wire form,
+// that is, a type_url field whose value is a string containing a type URL,
+// and optionally a value field with a string value, and no other fields. If
+// so, it returns the type URL and the value, if present.
+func anyFields(m Message) (url string, value *Value, ok bool) {
+	for _, f := range m {
+		if len(f.Values) != 1 || f.Values[0].Type != String || f.Values[0].Msg != nil {
+			return "", nil, false
+		}
+		switch f.Name {
+		case "type_url":
+			url = f.Values[0].Text
+		case "value":
+			value = f.Values[0]
+		default:
+			return "", nil, false
+		}
+	}
+	if !isTypeURL(url) || len(m) != 1+boolInt(value != nil) {
+		return "", nil, false
+	}
+	return url, value, true
+}
+
+// fieldName returns the JSON object key for a field with the given name.
+func (o JSONOptions) fieldName(name string) string {
+	if !isName.MatchString(name) {
+		if o.ExpandAny {
+			return "[" + name + "]"
+		}
+		return name
+	} else if o.CamelCase {
+		return jsonName(name)
+	}
+	return name
+}
+
+// fits32 reports whether the integer z, as returned by Value.integer, is in
+// the range of a 32-bit signed or unsigned integer.
+func fits32(z any) bool {
+	switch t := z.(type) {
+	case int64:
+		return t >= math.MinInt32 && t <= math.MaxUint32
+	case uint64:
+		return t <= math.MaxUint32
+	default:
+		return false
+	}
+}
+
+// isTypeURL reports whether name has the form of a type URL, as used for the
+// field name of an expanded Any message.
+func isTypeURL(name string) bool { return strings.Contains(name, "/") }
+
+// jsonName converts name to lowerCamelCase the way protoc does when
+// computing the default JSON name of a field: Underscores are removed, and a
+// lower-case letter following an underscore is capitalized.
+func jsonName(name string) string {
+	var sb strings.Builder
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upper = true
+			continue
+		} else if upper && 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// specialFloat reports whether s names an infinity or NaN, and if so returns
+// the corresponding value.
+func specialFloat(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "inf", "infinity":
+		return math.Inf(1), true
+	case "-inf", "-infinity":
+		return math.Inf(-1), true
+	case "nan":
+		return math.NaN(), true
+	}
+	return 0, false
+}
+
+// floatName returns the proto3 JSON string encoding of a non-finite value.
+func floatName(fp float64) string {
+	if math.IsNaN(fp) {
+		return "NaN"
+	} else if fp < 0 {
+		return "-Infinity"
+	}
+	return "Infinity"
+}
+
+// writeJSONString writes s to buf as a quoted JSON string. Invalid UTF-8
+// sequences are replaced by U+FFFD.
+func writeJSONString(buf jsonBuffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c == '\n':
+				buf.WriteString(`\n`)
+			case c == '\r':
+				buf.WriteString(`\r`)
+			case c == '\t':
+				buf.WriteString(`\t`)
+			case c < ' ' || c == 0x7f:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			default:
+				buf.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && n == 1 {
+			buf.WriteString("\ufffd")
+		} else {
+			buf.WriteString(s[i : i+n])
+		}
+		i += n
+	}
+	buf.WriteByte('"')
+}
+
 // SnakeToCamel converts a name in "snake_case" to "camelCase".
 func SnakeToCamel(name string) string {
 	var words []string
@@ -2,7 +2,12 @@
 
 package textpb
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
 
 func TestSnakeToCamel(t *testing.T) {
 	tests := []struct {
@@ -26,3 +31,141 @@ func TestSnakeToCamel(t *testing.T) {
 		}
 	}
 }
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		opts  JSONOptions
+		want  string
+	}{
+		{"", JSONOptions{}, `{}`},
+		{`a:1 b:"two" c:THREE d:true`, JSONOptions{}, `{"a":1,"b":"two","c":"THREE","d":true}`},
+		{`a:0x10 b:-2.5 c:1f`, JSONOptions{}, `{"a":16,"b":-2.5,"c":1}`},
+		{`s:"tab\tquote\"nl\n"`, JSONOptions{}, `{"s":"tab\tquote\"nl\n"}`},
+		{`a:inf b:-inf`, JSONOptions{}, `{"a":"inf","b":"-inf"}`},
+		{`a:18446744073709551615 b:0xfffffffffffffffff c:-0777`, JSONOptions{},
+			`{"a":18446744073709551615,"b":295147905179352825855,"c":-511}`},
+		{`[pkg.ext]: { x:1 }`, JSONOptions{}, `{"pkg.ext":{"x":1}}`},
+
+		// Proto3 mapping conventions.
+		{`small:-5 big:5000000000 neg:-5000000000 u32:4294967295`, Proto3JSON,
+			`{"small":-5,"big":"5000000000","neg":"-5000000000","u32":4294967295}`},
+		{`u64:0xffffffffffffffff`, Proto3JSON, `{"u64":"18446744073709551615"}`},
+		{`field_name:1 other__name_x:2 _lead:3 keep_ABC:4`, Proto3JSON,
+			`{"fieldName":1,"otherNameX":2,"Lead":3,"keepABC":4}`},
+		{`a:inf b:-inf c:nan d:-Infinity e:NAN`, Proto3JSON,
+			`{"a":"Infinity","b":"-Infinity","c":"NaN","d":"-Infinity","e":"NaN"}`},
+		{`any { [type.googleapis.com/pkg.Msg] { some_field:1 inner { y:2 } } }`, Proto3JSON,
+			`{"any":{"@type":"type.googleapis.com/pkg.Msg","someField":1,"inner":{"y":2}}}`},
+		{`[pkg.ext_field]: { x:1 }`, Proto3JSON, `{"[pkg.ext_field]":{"x":1}}`},
+		{`any { type_url: "type.googleapis.com/pkg.Msg" value: "\010\001" }`, Proto3JSON,
+			`{"any":{"@type":"type.googleapis.com/pkg.Msg","value":"CAE="}}`},
+		{`any { type_url: "type.googleapis.com/pkg.Msg" }`, Proto3JSON,
+			`{"any":{"@type":"type.googleapis.com/pkg.Msg"}}`},
+		{`any { type_url: "not a URL" value: "x" }`, Proto3JSON,
+			`{"any":{"typeUrl":"not a URL","value":"x"}}`},
+		{`any { type_url: "a/b" value: "x" extra: 1 }`, Proto3JSON,
+			`{"any":{"typeUrl":"a/b","value":"x","extra":1}}`},
+	}
+	for _, test := range tests {
+		msg, err := ParseString(test.input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.input, err)
+		}
+		got, err := test.opts.Marshal(msg)
+		if err != nil {
+			t.Errorf("Marshal %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("Marshal %q: got %s, want %s", test.input, got, test.want)
+		}
+	}
+
+	// A type name value, which the parser does not produce, is written as a
+	// string in brackets.
+	msg := Message{{Name: "v", Values: []*Value{{Type: TypeName, Text: "t.U"}}}}
+	if got, err := msg.MarshalJSON(); err != nil {
+		t.Errorf("Marshal %v: unexpected error: %v", msg, err)
+	} else if want := `{"v":"[t.U]"}`; string(got) != want {
+		t.Errorf("Marshal %v: got %s, want %s", msg, got, want)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{``, ``},
+		{`{}`, ``},
+		{`{"a":1,"b":"two","c":true,"d":false,"e":null}`, `a: 1 b: "two" c: true d: false e: null`},
+		{`{"big":18446744073709551616,"f":-2.5e-3}`, `big: 18446744073709551616 f: -2.5e-3`},
+		{`{"r":[1,2],"m":{"x":{}},"n":[{"y":1},{}]}`, `r: [1, 2] m { x {} } n [{ y: 1 }, {}]`},
+		{`{"[pkg.ext]":{"x":1}}`, `[pkg.ext] { x: 1 }`},
+		{`{"any":{"@type":"type.googleapis.com/pkg.Msg","v":1}}`,
+			`any { [type.googleapis.com/pkg.Msg] { v: 1 } }`},
+		{`{"any":{"@type":"type.googleapis.com/pkg.Msg","value":"CAE="}}`,
+			`any { type_url: "type.googleapis.com/pkg.Msg" value: "\010\001" }`},
+		{`{"any":{"@type":"type.googleapis.com/pkg.Msg","value":"not base64"}}`,
+			`any { [type.googleapis.com/pkg.Msg] { value: "not base64" } }`},
+	}
+	for _, test := range tests {
+		got, err := ParseJSON(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("ParseJSON %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		want, err := ParseString(test.want)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.want, err)
+		}
+		// The JSON value null is not a text-format value.
+		for _, v := range want.All() {
+			if v.Type == Name && v.Text == "null" {
+				v.Type = None
+			}
+		}
+		if diff := cmp.Diff(want.Combine(), got.Combine()); diff != "" {
+			t.Errorf("ParseJSON %q (-want, +got):\n%s", test.input, diff)
+		}
+	}
+
+	// An empty array is a field with no values.
+	if got, err := ParseJSON(strings.NewReader(`{"z":[]}`)); err != nil {
+		t.Errorf("ParseJSON: unexpected error: %v", err)
+	} else if diff := cmp.Diff(Message{{Name: "z"}}, got); diff != "" {
+		t.Errorf("ParseJSON (-want, +got):\n%s", diff)
+	}
+
+	for _, bad := range []string{`[1]`, `"x"`, `{"a":[[1]]}`, `{"a":1} {}`, `{"@type":1}`, `{"a":`} {
+		if got, err := ParseJSON(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseJSON %q: got %v, wanted error", bad, got)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		`a: 1 b: "two" c { d: true e: [1, 2] }`,
+		`any { [type.googleapis.com/pkg.Msg] { some_field: 1 } } [pkg.ext] { x: 1 }`,
+		`any { type_url: "type.googleapis.com/pkg.Msg" value: "\010\001\377" }`,
+	}
+	for _, input := range tests {
+		msg, err := ParseString(input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", input, err)
+		}
+		msg = msg.Combine()
+		data, err := JSONOptions{ExpandAny: true}.Marshal(msg)
+		if err != nil {
+			t.Fatalf("Marshal %q failed: %v", input, err)
+		}
+		got, err := ParseJSON(strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatalf("ParseJSON %s failed: %v", data, err)
+		}
+		if diff := cmp.Diff(msg, got.Combine()); diff != "" {
+			t.Errorf("Round trip %q (-want, +got):\n%s", input, diff)
+		}
+	}
+}
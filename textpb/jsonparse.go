@@ -0,0 +1,167 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+// This file adds conversion of JSON to messages.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseJSON parses a JSON object from r and returns a Message that represents
+// it, reversing the encoding done by MarshalJSON. The members of each object
+// become fields in the order given, and an array becomes the values of a
+// repeated field. Strings, numbers, Booleans, and null become values of type
+// String, Number, True or False, and None respectively. Numbers are copied
+// literally, without loss of precision.
+//
+// An object with an "@type" member is an expanded Any message, as written by
+// JSONOptions.ExpandAny: It becomes a message whose only field is named by
+// the type URL, with the other members as the fields of its value. If the
+// only other member is "value", whose value is a string in base64, the
+// object is an Any message in wire form, and becomes a message with a
+// type_url field and a value field holding the decoded bytes. A key in
+// square brackets, such as "[pkg.ext]", names an extension field.
+func ParseJSON(r io.Reader) (Message, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, fmt.Errorf("found %v, wanted JSON object", tok)
+	}
+	msg, err := parseJSONObject(dec)
+	if err != nil {
+		return nil, err
+	} else if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("extra data after JSON object")
+	} else if len(msg) == 0 {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// parseJSONObject parses the members of an object, assuming the opening brace
+// has already been read.
+func parseJSONObject(dec *json.Decoder) (Message, error) {
+	msg := Message{} // not nil, as that is the signal for a primitive
+	var typeURL string
+	isAny := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string) // the decoder ensures that object keys are strings
+		if key == "@type" {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			} else if typeURL, isAny = tok.(string); !isAny {
+				return nil, fmt.Errorf("found %v, wanted string for @type", tok)
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "[") && strings.HasSuffix(key, "]") {
+			key = key[1 : len(key)-1]
+		}
+		values, err := parseJSONValues(dec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		msg = append(msg, &Field{Name: key, Values: values})
+	}
+	if _, err := dec.Token(); err != nil { // the closing brace
+		return nil, err
+	}
+	if isAny {
+		if value, ok := anyValue(msg); ok {
+			return Message{
+				{Name: "type_url", Values: []*Value{{Type: String, Text: typeURL}}},
+				{Name: "value", Values: []*Value{{Type: String, Text: value}}},
+			}, nil
+		}
+		return Message{{Name: typeURL, Values: []*Value{{Msg: msg}}}}, nil
+	}
+	return msg, nil
+}
+
+// anyValue reports whether the only field of msg is a value field holding a
+// string in base64, as for an Any message in wire form, and if so returns the
+// decoded bytes.
+func anyValue(msg Message) (string, bool) {
+	if len(msg) != 1 || msg[0].Name != "value" || len(msg[0].Values) != 1 || msg[0].Values[0].Type != String {
+		return "", false
+	}
+	data, err := base64.StdEncoding.DecodeString(msg[0].Values[0].Text)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// parseJSONValues parses the value of an object member. An array gives one
+// value for each element; any other JSON value gives a single value.
+func parseJSONValues(dec *json.Decoder) ([]*Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	} else if tok != json.Delim('[') {
+		v, err := parseJSONValue(dec, tok)
+		if err != nil {
+			return nil, err
+		}
+		return []*Value{v}, nil
+	}
+
+	var values []*Value
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		} else if tok == json.Delim('[') {
+			return nil, errors.New("nested arrays are not supported")
+		}
+		v, err := parseJSONValue(dec, tok)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if _, err := dec.Token(); err != nil { // the closing bracket
+		return nil, err
+	}
+	return values, nil
+}
+
+// parseJSONValue parses a value that begins with tok, which is not an array.
+func parseJSONValue(dec *json.Decoder, tok json.Token) (*Value, error) {
+	switch t := tok.(type) {
+	case json.Delim: // the decoder ensures this is an opening brace
+		msg, err := parseJSONObject(dec)
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Msg: msg}, nil
+	case string:
+		return &Value{Type: String, Text: t}, nil
+	case json.Number:
+		return &Value{Type: Number, Text: t.String()}, nil
+	case bool:
+		if t {
+			return &Value{Type: True, Text: "true"}, nil
+		}
+		return &Value{Type: False, Text: "false"}, nil
+	case nil:
+		return &Value{Type: None, Text: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
@@ -4,7 +4,13 @@ package textpb
 
 // This file adds split/combine and other utility code.
 
-import "sort"
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sort"
+)
 
 // ToCamel recursively renames each field of m in-place, converting names in
 // "snake_case" names to "camelCase".
@@ -29,7 +35,8 @@ func (v *Value) toCamel() {
 
 // Combine returns a copy of m in which each field name occurs exactly once,
 // with all the values assigned to that field name.  This process is applied
-// recursively to nested messages.
+// recursively to nested messages. The comments of the fields with a name are
+// kept in order; a line comment after the first becomes a trailing comment.
 func (m Message) Combine() Message {
 	names := make(map[string]*Field)
 	for _, field := range m {
@@ -38,6 +45,14 @@ func (m Message) Combine() Message {
 			of = &Field{Name: field.Name}
 			names[field.Name] = of
 		}
+		of.Comments = append(of.Comments, field.Comments...)
+		if of.LineComment == "" {
+			of.LineComment = field.LineComment
+		} else if field.LineComment != "" {
+			of.Trailing = append(of.Trailing, field.LineComment)
+		}
+		of.Trailing = append(of.Trailing, field.Trailing...)
+		of.Inner = append(of.Inner, field.Inner...)
 		for _, v := range field.Values {
 			of.Values = append(of.Values, v.combine())
 		}
@@ -52,64 +67,174 @@ func (m Message) Combine() Message {
 
 // RSplit recursively partitions m into multiple messages with the property
 // that each field of each resulting message has at most one value.
-func (m Message) RSplit() []Message { return m.Combine().split(true) }
+func (m Message) RSplit() []Message { return slices.Collect(m.RSplitSeq()) }
 
 // Split partitions m into multiple messages with the property that each field
 // of each resulting message has at most one value.
-func (m Message) Split() []Message { return m.Combine().split(false) }
+func (m Message) Split() []Message { return slices.Collect(m.SplitSeq()) }
 
-func (m Message) split(recur bool) []Message {
-	var all [][]*Field // the results of partitioning all the fields
-	for _, f := range m {
-		if fs := f.split(recur); len(fs) > 0 {
-			all = append(all, fs)
+// SplitOn partitions m into multiple messages, one for each combination of
+// the values of the fields named by paths, with all other fields copied
+// unchanged. Each path has the form described for JoinPath. For a nested path
+// such as "a.b", the messages along the path are also partitioned, so that
+// in each resulting message both a and a.b have at most one value.
+func (m Message) SplitOn(paths ...string) []Message {
+	return slices.Collect(m.Combine().split(newPathSpec(paths)))
+}
+
+// RSplitSeq returns an iterator over the messages returned by RSplit. The
+// messages are generated as needed, rather than all at once.
+func (m Message) RSplitSeq() iter.Seq[Message] { return m.Combine().split(allSpec(true)) }
+
+// SplitSeq returns an iterator over the messages returned by Split. The
+// messages are generated as needed, rather than all at once.
+func (m Message) SplitSeq() iter.Seq[Message] { return m.Combine().split(allSpec(false)) }
+
+// ErrSplitLimit is reported by SplitWith when splitting a message would
+// produce more messages than the limit allows.
+var ErrSplitLimit = errors.New("split limit exceeded")
+
+// SplitOptions control the behaviour of SplitWith.
+type SplitOptions struct {
+	Recursive bool     // split nested messages, as RSplit does
+	Paths     []string // if non-empty, split only these fields, as SplitOn does
+	Limit     int      // if positive, the maximum number of messages to produce
+}
+
+// SplitWith returns an iterator over the messages produced by splitting m
+// according to opts. If opts.Limit is positive and splitting m would produce
+// more than that many messages, SplitWith reports ErrSplitLimit without
+// producing any.
+func (m Message) SplitWith(opts SplitOptions) (iter.Seq[Message], error) {
+	spec := allSpec(opts.Recursive)
+	if len(opts.Paths) != 0 {
+		spec = newPathSpec(opts.Paths)
+	}
+	c := m.Combine()
+	if opts.Limit > 0 {
+		if c.splitCount(spec, opts.Limit) > opts.Limit {
+			return nil, fmt.Errorf("%w: more than %d messages", ErrSplitLimit, opts.Limit)
 		}
 	}
+	return c.split(spec), nil
+}
+
+// A splitSpec selects which fields of a message are split.
+type splitSpec struct {
+	recur bool     // split the fields of nested messages
+	paths pathTree // if non-nil, split only these fields
+}
 
-	// Accumulates the result messages.
-	var result []Message
+// A pathTree records a set of field paths, keyed by the first name of each.
+type pathTree map[string]pathTree
 
-	// A slice of indexes into the field sets returned by expansion.
-	// Each idx[i] is in the range [0,len(all[i])) and denotes the
-	// position of the next field value to be consumed.
-	idx := make([]int, len(all))
+func allSpec(recur bool) splitSpec { return splitSpec{recur: recur} }
 
-	done := false
-	for !done {
-		// Increment the index vector.
-		for i, x := range idx {
-			idx[i] = (x + 1) % len(all[i])
-			if idx[i] != 0 {
-				break
+func newPathSpec(paths []string) splitSpec {
+	root := make(pathTree)
+	for _, path := range paths {
+		cur := root
+		for _, name := range SplitPath(path) {
+			if cur[name] == nil {
+				cur[name] = make(pathTree)
 			}
-			done = i+1 == len(idx)
+			cur = cur[name]
+		}
+	}
+	return splitSpec{recur: len(root) != 0, paths: root}
+}
+
+// field reports whether the field with the given name should be split, and
+// if so the spec to apply to its message values.
+func (s splitSpec) field(name string) (splitSpec, bool) {
+	if s.paths == nil {
+		return s, true
+	}
+	sub, ok := s.paths[name]
+	return splitSpec{recur: len(sub) != 0, paths: sub}, ok
+}
+
+func (m Message) split(s splitSpec) iter.Seq[Message] {
+	var all []iter.Seq[*Field] // the partitions of each field
+	for _, f := range m {
+		if sub, ok := s.field(f.Name); ok && len(f.Values) > 0 {
+			all = append(all, f.split(sub))
+		} else {
+			all = append(all, slices.Values([]*Field{f}))
 		}
+	}
+	return product(all)
+}
 
-		// Copy the index values into the result.
-		next := make(Message, len(idx))
-		for i, x := range idx {
-			next[i] = all[i][x]
+// product returns an iterator over the cartesian product of the field
+// sequences in all, each combination forming a new message. The first
+// sequence varies fastest. If all is empty, the result is a single empty
+// message.
+func product(all []iter.Seq[*Field]) iter.Seq[Message] {
+	return func(yield func(Message) bool) {
+		cur := make(Message, len(all))
+
+		// Fill positions i, i-1, ..., 0 of cur in all possible ways.
+		var fill func(i int) bool
+		fill = func(i int) bool {
+			if i < 0 {
+				return yield(slices.Clone(cur))
+			}
+			for f := range all[i] {
+				cur[i] = f
+				if !fill(i - 1) {
+					return false
+				}
+			}
+			return true
 		}
-		result = append(result, next)
+		fill(len(all) - 1)
 	}
+}
 
-	return result
+// splitCount returns the number of messages m.split(s) would produce, or a
+// value greater than limit if the number exceeds limit.
+func (m Message) splitCount(s splitSpec, limit int) int {
+	n := 1
+	for _, f := range m {
+		sub, ok := s.field(f.Name)
+		if !ok || len(f.Values) == 0 {
+			continue
+		}
+		k := f.splitCount(sub, limit)
+		if k > limit/n {
+			return limit + 1
+		}
+		n *= k
+	}
+	return n
 }
 
-func (f *Field) split(recur bool) []*Field {
-	if len(f.Values) == 0 {
-		return nil
+func (f *Field) split(s splitSpec) iter.Seq[*Field] {
+	return func(yield func(*Field) bool) {
+		for _, v := range f.Values {
+			for vs := range v.split(s) {
+				if !yield(&Field{Name: f.Name, Values: []*Value{vs}}) {
+					return
+				}
+			}
+		}
 	}
-	var fs []*Field
+}
+
+func (f *Field) splitCount(s splitSpec, limit int) int {
+	var n int
 	for _, v := range f.Values {
-		for _, vs := range v.split(recur) {
-			fs = append(fs, &Field{
-				Name:   f.Name,
-				Values: []*Value{vs},
-			})
+		if s.recur && v.Msg != nil {
+			n += v.Msg.splitCount(s, limit)
+		} else {
+			n++
+		}
+		if n > limit {
+			return limit + 1
 		}
 	}
-	return fs
+	return n
 }
 
 func (v *Value) combine() *Value {
@@ -119,13 +244,16 @@ func (v *Value) combine() *Value {
 	return &Value{Msg: v.Msg.Combine()}
 }
 
-func (v *Value) split(recur bool) []*Value {
-	if v.Msg == nil || !recur {
-		return []*Value{v}
-	}
-	var vs []*Value
-	for _, msg := range v.Msg.split(recur) {
-		vs = append(vs, &Value{Msg: msg})
+func (v *Value) split(s splitSpec) iter.Seq[*Value] {
+	return func(yield func(*Value) bool) {
+		if v.Msg == nil || !s.recur {
+			yield(v)
+			return
+		}
+		for msg := range v.Msg.split(s) {
+			if !yield(&Value{Msg: msg}) {
+				return
+			}
+		}
 	}
-	return vs
 }
@@ -0,0 +1,169 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func jsonStrings(t *testing.T, msgs []Message) []string {
+	t.Helper()
+	var out []string
+	for _, msg := range msgs {
+		data, err := msg.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON failed: %v", err)
+		}
+		out = append(out, string(data))
+	}
+	return out
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input       string
+		split, recr []string
+	}{
+		{"", []string{`{}`}, []string{`{}`}},
+		{"a:1", []string{`{"a":1}`}, []string{`{"a":1}`}},
+		{"a:1 a:2 b:3",
+			[]string{`{"a":1,"b":3}`, `{"a":2,"b":3}`},
+			[]string{`{"a":1,"b":3}`, `{"a":2,"b":3}`}},
+		{"b:3 a:1 b:4 a:2",
+			[]string{`{"a":1,"b":3}`, `{"a":2,"b":3}`, `{"a":1,"b":4}`, `{"a":2,"b":4}`},
+			[]string{`{"a":1,"b":3}`, `{"a":2,"b":3}`, `{"a":1,"b":4}`, `{"a":2,"b":4}`}},
+		{"a { x:1 x:2 }",
+			[]string{`{"a":{"x":[1,2]}}`},
+			[]string{`{"a":{"x":1}}`, `{"a":{"x":2}}`}},
+	}
+	for _, test := range tests {
+		msg, err := ParseString(test.input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.input, err)
+		}
+		if diff := cmp.Diff(test.split, jsonStrings(t, msg.Split())); diff != "" {
+			t.Errorf("Split %q (-want, +got):\n%s", test.input, diff)
+		}
+		if diff := cmp.Diff(test.recr, jsonStrings(t, msg.RSplit())); diff != "" {
+			t.Errorf("RSplit %q (-want, +got):\n%s", test.input, diff)
+		}
+	}
+}
+
+func TestSplitWith(t *testing.T) {
+	// Five fields of 100 values each: 10^10 combinations.
+	var sb strings.Builder
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		for i := range 100 {
+			fmt.Fprintf(&sb, "%s: %d\n", name, i)
+		}
+	}
+	msg, err := ParseString(sb.String())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// Without a limit, results are generated lazily.
+	seq, err := msg.SplitWith(SplitOptions{})
+	if err != nil {
+		t.Fatalf("SplitWith: unexpected error: %v", err)
+	}
+	var got []Message
+	for m := range seq {
+		got = append(got, m)
+		if len(got) == 3 {
+			break
+		}
+	}
+	want := []string{
+		`{"a":0,"b":0,"c":0,"d":0,"e":0}`,
+		`{"a":1,"b":0,"c":0,"d":0,"e":0}`,
+		`{"a":2,"b":0,"c":0,"d":0,"e":0}`,
+	}
+	if diff := cmp.Diff(want, jsonStrings(t, got)); diff != "" {
+		t.Errorf("SplitWith (-want, +got):\n%s", diff)
+	}
+
+	// With a limit, the product is rejected.
+	if _, err := msg.SplitWith(SplitOptions{Limit: 1000000}); !errors.Is(err, ErrSplitLimit) {
+		t.Errorf("SplitWith: got error %v, want %v", err, ErrSplitLimit)
+	}
+
+	// Recursive counts include nested messages.
+	nested, err := ParseString("a { x:1 x:2 x:3 } a { y:1 y:2 } b:1 b:2")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for _, test := range []struct {
+		opts SplitOptions
+		ok   bool
+	}{
+		{SplitOptions{Limit: 4}, true},
+		{SplitOptions{Limit: 3}, false},
+		{SplitOptions{Recursive: true, Limit: 10}, true},
+		{SplitOptions{Recursive: true, Limit: 9}, false},
+	} {
+		_, err := nested.SplitWith(test.opts)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("SplitWith %+v: got error %v, want success=%v", test.opts, err, test.ok)
+		}
+	}
+}
+
+func TestSplitOn(t *testing.T) {
+	const input = `id: 1 tag: "x" tag: "y"
+items { name: "a" part: 1 part: 2 }
+items { name: "b" part: 3 }`
+	msg, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tests := []struct {
+		paths []string
+		want  []string
+	}{
+		{nil, []string{
+			`{"id":1,"items":[{"name":"a","part":[1,2]},{"name":"b","part":3}],"tag":["x","y"]}`,
+		}},
+		{[]string{"items"}, []string{
+			`{"id":1,"items":{"name":"a","part":[1,2]},"tag":["x","y"]}`,
+			`{"id":1,"items":{"name":"b","part":3},"tag":["x","y"]}`,
+		}},
+		{[]string{"items.part"}, []string{
+			`{"id":1,"items":{"name":"a","part":1},"tag":["x","y"]}`,
+			`{"id":1,"items":{"name":"a","part":2},"tag":["x","y"]}`,
+			`{"id":1,"items":{"name":"b","part":3},"tag":["x","y"]}`,
+		}},
+		{[]string{"tag", "items"}, []string{
+			`{"id":1,"items":{"name":"a","part":[1,2]},"tag":"x"}`,
+			`{"id":1,"items":{"name":"b","part":3},"tag":"x"}`,
+			`{"id":1,"items":{"name":"a","part":[1,2]},"tag":"y"}`,
+			`{"id":1,"items":{"name":"b","part":3},"tag":"y"}`,
+		}},
+		{[]string{"nonesuch.foo"}, []string{
+			`{"id":1,"items":[{"name":"a","part":[1,2]},{"name":"b","part":3}],"tag":["x","y"]}`,
+		}},
+	}
+	for _, test := range tests {
+		got := jsonStrings(t, msg.SplitOn(test.paths...))
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("SplitOn %q (-want, +got):\n%s", test.paths, diff)
+		}
+		if len(test.paths) == 0 {
+			continue // SplitWith treats this as a plain Split
+		}
+		if _, err := msg.SplitWith(SplitOptions{Paths: test.paths, Limit: len(test.want)}); err != nil {
+			t.Errorf("SplitWith %q: unexpected error: %v", test.paths, err)
+		}
+		if len(test.want) > 1 {
+			if _, err := msg.SplitWith(SplitOptions{Paths: test.paths, Limit: len(test.want) - 1}); err == nil {
+				t.Errorf("SplitWith %q: got success, wanted limit error", test.paths)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+// Package msgpack encodes textpb.Message values in the MessagePack format
+// described at https://msgpack.org.
+//
+// The encoding is deterministic: Map keys are sorted by name, and integers,
+// lengths, and floating-point values use their shortest exact forms.
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+// Marshal returns the MessagePack encoding of msg as a map, after combining
+// fields with the same name. A field with one value maps to that value, and
+// other fields map to arrays. Integers are encoded exactly; since MessagePack
+// has no representation for integers that do not fit in 64 bits, those are
+// encoded as strings of decimal digits. Strings that are not valid UTF-8 are
+// encoded as binary. Type names are encoded as strings in square brackets, as
+// for textpb.MarshalJSON.
+func Marshal(msg textpb.Message) ([]byte, error) {
+	var e encoder
+	if err := e.message(msg.Combine()); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Encode writes the MessagePack encoding of msg to w, as described for Marshal.
+func Encode(w io.Writer, msg textpb.Message) error {
+	data, err := Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+// head appends the header of an item of length n, using the fixed-size form
+// whose tag is fix if n <= fixMax, and otherwise the first of tags whose
+// length field (1, 2, or 4 bytes) can hold n.
+func (e *encoder) head(n int, fix byte, fixMax int, tags [3]byte) {
+	switch {
+	case n <= fixMax:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint8 && tags[0] != 0:
+		e.buf = append(e.buf, tags[0], byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, tags[1]), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, tags[2]), uint32(n))
+	}
+}
+
+func (e *encoder) mapHead(n int)   { e.head(n, 0x80, 15, [3]byte{0, 0xde, 0xdf}) }
+func (e *encoder) arrayHead(n int) { e.head(n, 0x90, 15, [3]byte{0, 0xdc, 0xdd}) }
+
+func (e *encoder) str(s string) {
+	if utf8.ValidString(s) {
+		e.head(len(s), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+	} else {
+		e.head(len(s), 0xc4, -1, [3]byte{0xc4, 0xc5, 0xc6})
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xce), uint32(u))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcf), u)
+	}
+}
+
+func (e *encoder) int(z int64) {
+	switch {
+	case z >= 0:
+		e.uint(uint64(z))
+	case z >= -32:
+		e.buf = append(e.buf, byte(z))
+	case z >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(z))
+	case z >= math.MinInt16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xd1), uint16(z))
+	case z >= math.MinInt32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd2), uint32(z))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(z))
+	}
+}
+
+func (e *encoder) message(msg textpb.Message) error {
+	fields := make([]*textpb.Field, len(msg))
+	copy(fields, msg)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+
+	e.mapHead(len(fields))
+	for _, f := range fields {
+		e.str(f.Name)
+		if len(f.Values) != 1 {
+			e.arrayHead(len(f.Values))
+		}
+		for _, v := range f.Values {
+			if err := e.value(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *encoder) value(v *textpb.Value) error {
+	if v.Msg != nil {
+		return e.message(v.Msg)
+	}
+	switch v.Type {
+	case textpb.None:
+		e.buf = append(e.buf, 0xc0)
+	case textpb.True:
+		e.buf = append(e.buf, 0xc3)
+	case textpb.False:
+		e.buf = append(e.buf, 0xc2)
+	case textpb.Name, textpb.String:
+		e.str(v.Text)
+	case textpb.TypeName:
+		e.str("[" + v.Text + "]")
+	case textpb.Number:
+		return e.number(v)
+	default:
+		return fmt.Errorf("invalid value type: %v", v.Type)
+	}
+	return nil
+}
+
+func (e *encoder) number(v *textpb.Value) error {
+	if !v.NumberKind().IsInteger() {
+		fp, err := v.Number()
+		if err != nil {
+			return fmt.Errorf("inconvertible number %q", v.Text)
+		}
+		if f32 := float32(fp); float64(f32) == fp || math.IsNaN(fp) {
+			e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xca), math.Float32bits(f32))
+		} else {
+			e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcb), math.Float64bits(fp))
+		}
+		return nil
+	}
+	if z, err := v.Fixed(); err == nil {
+		e.int(z)
+	} else if u, err := v.Uint(); err == nil {
+		e.uint(u)
+	} else if b, err := v.BigInt(); err == nil {
+		e.str(b.String())
+	} else {
+		return fmt.Errorf("inconvertible number %q", v.Text)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/pson/textpb"
+	"github.com/creachadair/pson/textpb/msgpack"
+)
+
+func mustMarshal(t *testing.T, s string) string {
+	t.Helper()
+	msg, err := textpb.ParseString(s)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", s, err)
+	}
+	data, err := msgpack.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal %q: unexpected error: %v", s, err)
+	}
+	return hex.EncodeToString(data)
+}
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"0", "00"},
+		{"127", "7f"},
+		{"128", "cc80"},
+		{"0x100", "cd0100"},
+		{"70000", "ce00011170"},
+		{"4294967296", "cf0000000100000000"},
+		{"18446744073709551615", "cfffffffffffffffff"},
+		{"-1", "ff"},
+		{"-32", "e0"},
+		{"-33", "d0df"},
+		{"-129", "d1ff7f"},
+		{"-32769", "d2ffff7fff"},
+		{"-9223372036854775808", "d38000000000000000"},
+		{"18446744073709551616", "b4" + hex.EncodeToString([]byte("18446744073709551616"))},
+		{"1.5", "ca3fc00000"},
+		{"1.1", "cb3ff199999999999a"},
+		{"-inf", "caff800000"},
+		{"true", "c3"},
+		{"false", "c2"},
+		{`""`, "a0"},
+		{`"abc"`, "a3616263"},
+		{`"` + strings.Repeat("x", 32) + `"`, "d920" + strings.Repeat("78", 32)},
+		{"ENUM", "a4454e554d"},
+	}
+	for _, test := range tests {
+		// The value is wrapped as {"v": value}.
+		want := "81a176" + test.want
+		if got := mustMarshal(t, "v: "+test.value); got != want {
+			t.Errorf("Marshal %q: got %s, want %s", test.value, got, want)
+		}
+	}
+
+	// A type name value, which the text parser does not produce, is written
+	// as a string in brackets.
+	msg := textpb.Message{{Name: "v", Values: []*textpb.Value{{Type: textpb.TypeName, Text: "a.B"}}}}
+	if data, err := msgpack.Marshal(msg); err != nil {
+		t.Errorf("Marshal %v: unexpected error: %v", msg, err)
+	} else if got, want := hex.EncodeToString(data), "81a176a55b612e425d"; got != want {
+		t.Errorf("Marshal %v: got %s, want %s", msg, got, want)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", "80"},
+
+		// Keys are sorted by name.
+		{"bb: 1 a: 2 c: 3", "83a161" + "02" + "a26262" + "01" + "a163" + "03"},
+
+		// Repeated fields are combined into arrays.
+		{"a: 1 b {} a: 2", "82a161920102a16280"},
+		{"a { x: 1 } a { y: 2 }", "81a1619281a1780181a17902"},
+	}
+	for _, test := range tests {
+		if got := mustMarshal(t, test.input); got != test.want {
+			t.Errorf("Marshal %q: got %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	msg := textpb.Message{{
+		Name:   "s",
+		Values: []*textpb.Value{{Type: textpb.String, Text: "\xff"}},
+	}}
+	want := []byte{0x81, 0xa1, 's', 0xc4, 0x01, 0xff} // bin, not str
+	got, err := msgpack.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: unexpected error: %v", err)
+	} else if !bytes.Equal(got, want) {
+		t.Errorf("Marshal: got %x, want %x", got, want)
+	}
+}
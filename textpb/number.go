@@ -0,0 +1,93 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A NumberKind classifies the lexical form of a numeric literal.
+type NumberKind int
+
+// Constants defining the kinds of numeric literals.
+const (
+	NotNumber NumberKind = iota // not a numeric literal
+	Signed                      // decimal integer with a leading minus sign
+	Unsigned                    // decimal integer without a sign
+	Hex                         // hexadecimal integer, e.g., 0x1f
+	Octal                       // octal integer, e.g., 0755
+	Float                       // floating-point value
+)
+
+var kindString = map[NumberKind]string{
+	NotNumber: "not a number",
+	Signed:    "signed",
+	Unsigned:  "unsigned",
+	Hex:       "hex",
+	Octal:     "octal",
+	Float:     "float",
+}
+
+func (k NumberKind) String() string { return kindString[k] }
+
+// IsInteger reports whether k is one of the integer kinds.
+func (k NumberKind) IsInteger() bool { return k == Signed || k == Unsigned || k == Hex || k == Octal }
+
+// NumberKind reports the lexical form of v, which is NotNumber unless v is a
+// Number token.
+func (v *Value) NumberKind() NumberKind {
+	if v.Msg != nil || v.Type != Number {
+		return NotNumber
+	}
+	digits := strings.TrimPrefix(v.Text, "-")
+	switch {
+	case isFixed.MatchString(v.Text):
+		return Hex
+	case strings.Trim(digits, "0123456789") != "":
+		return Float // decimal point, exponent, suffix, or infinity
+	case len(digits) > 1 && digits[0] == '0':
+		if strings.Trim(digits, "01234567") != "" {
+			return Float // e.g., 09, which is not valid octal
+		}
+		return Octal
+	case digits != v.Text:
+		return Signed
+	default:
+		return Unsigned
+	}
+}
+
+// Uint returns the value of v as an unsigned 64-bit integer, if possible.
+func (v *Value) Uint() (uint64, error) { return strconv.ParseUint(v.Text, 0, 64) }
+
+// BigInt returns the value of v as an integer of arbitrary precision, if
+// possible.
+func (v *Value) BigInt() (*big.Int, error) {
+	if !v.NumberKind().IsInteger() {
+		return nil, fmt.Errorf("invalid integer %q", v.Text)
+	}
+	z, ok := new(big.Int).SetString(v.Text, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %q", v.Text)
+	}
+	return z, nil
+}
+
+// integer returns the value of v as the narrowest of int64, uint64, or
+// *big.Int that can represent it exactly. It reports false if v is not an
+// integer.
+func (v *Value) integer() (any, bool) {
+	if !v.NumberKind().IsInteger() {
+		return nil, false
+	} else if z, err := v.Fixed(); err == nil {
+		return z, true
+	} else if u, err := v.Uint(); err == nil {
+		return u, true
+	} else if b, err := v.BigInt(); err == nil {
+		return b, true
+	}
+	return nil, false
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import "testing"
+
+func TestNumberKind(t *testing.T) {
+	tests := []struct {
+		input string
+		want  NumberKind
+	}{
+		{"0", Unsigned},
+		{"25", Unsigned},
+		{"-0", Signed},
+		{"-25", Signed},
+		{"0x1F", Hex},
+		{"-0xabc", Hex},
+		{"0755", Octal},
+		{"-017", Octal},
+		{"089", Float},
+		{"1.5", Float},
+		{"1e6", Float},
+		{"3f", Float},
+		{"-inf", Float},
+		{"18446744073709551615", Unsigned},
+	}
+	for _, test := range tests {
+		v := &Value{Type: Number, Text: test.input}
+		if got := v.NumberKind(); got != test.want {
+			t.Errorf("NumberKind(%q): got %v, want %v", test.input, got, test.want)
+		}
+	}
+	if got := (&Value{Type: Name, Text: "x"}).NumberKind(); got != NotNumber {
+		t.Errorf("NumberKind(name): got %v, want %v", got, NotNumber)
+	}
+}
+
+func TestIntegers(t *testing.T) {
+	tests := []struct {
+		input, big string
+		uint       uint64
+		uok        bool
+	}{
+		{"0", "0", 0, true},
+		{"-1", "-1", 0, false},
+		{"0xffffffffffffffff", "18446744073709551615", 1<<64 - 1, true},
+		{"0777", "511", 511, true},
+		{"18446744073709551616", "18446744073709551616", 0, false},
+		{"-0x10000000000000000", "-18446744073709551616", 0, false},
+	}
+	for _, test := range tests {
+		v := &Value{Type: Number, Text: test.input}
+		u, err := v.Uint()
+		if test.uok && (err != nil || u != test.uint) {
+			t.Errorf("Uint(%q): got (%v, %v), want %v", test.input, u, err, test.uint)
+		} else if !test.uok && err == nil {
+			t.Errorf("Uint(%q): got %v, want error", test.input, u)
+		}
+		b, err := v.BigInt()
+		if err != nil {
+			t.Errorf("BigInt(%q): unexpected error: %v", test.input, err)
+		} else if got := b.String(); got != test.big {
+			t.Errorf("BigInt(%q): got %s, want %s", test.input, got, test.big)
+		}
+	}
+	if b, err := (&Value{Type: Number, Text: "1.5"}).BigInt(); err == nil {
+		t.Errorf("BigInt(1.5): got %v, want error", b)
+	}
+}
@@ -32,6 +32,8 @@ func (m Message) ToValue() (any, error) {
 
 // ToValue converts v into an interface{} value, which is either a map (if v is
 // a Message), a primitive value, or a slice of arbitrary values for an array.
+// Integers are converted to int64 if possible, otherwise uint64, otherwise
+// *big.Int.
 func (v *Value) ToValue() (any, error) {
 	if v.Msg != nil {
 		return v.Msg.ToValue()
@@ -46,8 +48,8 @@ func (v *Value) ToValue() (any, error) {
 	case False:
 		return false, nil
 	case Number:
-		if fix, err := v.Fixed(); err == nil {
-			return fix, nil
+		if z, ok := v.integer(); ok {
+			return z, nil
 		} else if fp, err := v.Number(); err == nil {
 			return fp, nil
 		}
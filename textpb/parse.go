@@ -23,6 +23,14 @@ func (m Message) Less(i, j int) bool { return m[i].Name < m[j].Name }
 type Field struct {
 	Name   string
 	Values []*Value
+
+	// Comments recorded by Parse, without their leading "#". Comments that
+	// follow the last field of a message are attached to that field; those in
+	// a message with no fields are attached to the enclosing field as Inner.
+	Comments    []string // comment lines preceding the field
+	LineComment string   // a comment on the same line as the end of the field
+	Trailing    []string // comment lines following the field
+	Inner       []string // comment lines inside an empty message value
 }
 
 func (f *Field) String() string { return fmt.Sprintf("#<field name=%q values=%+v>", f.Name, f.Values) }
@@ -51,7 +59,14 @@ func (v *Value) Fixed() (int64, error) { return strconv.ParseInt(v.Text, 0, 64)
 // Number returns the value of v as a floating-point number, if possible.
 func (v *Value) Number() (float64, error) { return strconv.ParseFloat(noFixTag(v.Text), 64) }
 
-func noFixTag(s string) string { return strings.TrimSuffix(strings.ToLower(s), "f") }
+// noFixTag removes the "f" suffix from a floating-point literal, if present.
+func noFixTag(s string) string {
+	s = strings.ToLower(s)
+	if strings.HasSuffix(s, "inf") {
+		return s
+	}
+	return strings.TrimSuffix(s, "f")
+}
 
 // Bool returns the value of v as a Boolean, if possible.
 func (v *Value) Bool() (bool, error) {
@@ -67,111 +82,310 @@ func (v *Value) Bool() (bool, error) {
 
 // Parse parses the input from r and returns a Message that represents it.
 func Parse(r io.Reader) (Message, error) {
-	p := parser{NewScanner(r)}
-	if !p.Next() {
-		if err := p.Err(); err != nil && err != io.EOF {
-			return nil, p.fail(err.Error())
-		}
+	var b builder
+	if err := Stream(r, &b); err != nil {
+		return nil, err
+	} else if len(b.root) == 0 {
 		return nil, nil
 	}
-	return p.parseMessage(None)
+	return b.root, nil
 }
 
 // ParseString applies Parse to the specified string.
 func ParseString(s string) (Message, error) { return Parse(strings.NewReader(s)) }
 
+// A Handler receives events describing the structure of a message as it is
+// parsed by Stream. If a method of the handler reports an error, parsing
+// stops and that error is returned to the caller of Stream.
+type Handler interface {
+	// BeginMessage is called at the start of a message. This includes the
+	// top-level message as well as the value of each message field.
+	BeginMessage() error
+
+	// EndMessage is called at the end of the current message.
+	EndMessage() error
+
+	// BeginField is called with the name of each field. It is followed
+	// either by a call to Value, or by BeginMessage for a message field. A
+	// field in list syntax, "name: [a, b]", is reported as a sequence of
+	// fields with the same name, one for each element of the list.
+	BeginField(name string) error
+
+	// Value is called with the type and text of the primitive value of the
+	// current field. Consecutive string literals are concatenated.
+	Value(tok Token, text string) error
+}
+
+// A CommentHandler is a Handler that also receives the comments in the input.
+// If the handler given to Stream implements this interface, comments are
+// reported to it in addition to the other events.
+type CommentHandler interface {
+	Handler
+
+	// LineComment is called with the text of a comment that follows the
+	// preceding field on the same line.
+	LineComment(text string) error
+
+	// Comments is called with the text of comment lines preceding the next
+	// call to BeginField or EndMessage.
+	Comments(text []string) error
+}
+
+// Stream parses the input from r and reports its structure to h as a
+// sequence of events, without constructing a Message. Memory use does not
+// depend on the size of the input, apart from the lengths of individual
+// tokens and the depth of nesting.
+func Stream(r io.Reader, h Handler) error {
+	p := parser{Scanner: NewScanner(r), h: h}
+	if err := h.BeginMessage(); err != nil {
+		return err
+	}
+	if p.Next() {
+		if err := p.parseMessage(None); err != nil {
+			return err
+		}
+	} else if err := p.comments(false); err != nil {
+		return err
+	}
+	if err := p.Err(); err != nil && err != io.EOF {
+		return p.fail(err.Error())
+	}
+	return h.EndMessage()
+}
+
 type parser struct {
 	*Scanner
+	h Handler
 }
 
 func (p parser) fail(msg string, args ...any) error {
 	return fmt.Errorf(fmt.Sprintf("line %d: ", p.Line())+msg, args...)
 }
 
-func (p parser) parseMessage(until Token) (Message, error) {
-	msg := Message{} // not nil, as that is the signal for a primitive
-	for {
+// comments reports the comments preceding the current token, if the handler
+// accepts them. If after is true, a comment on the same line as the previous
+// token is reported as a line comment for the preceding field.
+func (p parser) comments(after bool) error {
+	text, inline := p.Comments()
+	ch, ok := p.h.(CommentHandler)
+	if !ok || len(text) == 0 {
+		return nil
+	}
+	if inline && after {
+		if err := ch.LineComment(text[0]); err != nil {
+			return err
+		}
+		text = text[1:]
+	}
+	if len(text) == 0 {
+		return nil
+	}
+	return ch.Comments(text)
+}
+
+func (p parser) parseMessage(until Token) error {
+	for first := true; ; first = false {
+		if err := p.comments(!first); err != nil {
+			return err
+		}
 		tok := p.Token()
 		if tok == until {
-			return msg, nil
+			return nil
+		} else if tok == LeftS {
+			// A bracket in field-name position begins a type name.
+			if !p.ScanTypeName() {
+				return p.fail(p.Err().Error())
+			}
+			tok = TypeName
 		} else if tok != Name && tok != TypeName {
-			return nil, p.fail("found %v, wanted name or type", tok)
+			return p.fail("found %v, wanted name or type", tok)
 		}
 		name := p.Text()
+		if err := p.h.BeginField(name); err != nil {
+			return err
+		}
 
 		if !p.Next() {
-			return nil, p.fail("found %v, wanted %v or message", tok, Colon)
+			return p.fail("found %v, wanted %v or message", tok, Colon)
 		}
-		var field *Field
 		var err error
 		switch p.Token() {
 		case LeftA:
-			field, err = p.parseMessageField(name, RightA)
+			err = p.parseMessageField(RightA)
 		case LeftC:
-			field, err = p.parseMessageField(name, RightC)
+			err = p.parseMessageField(RightC)
+		case LeftS:
+			// Without a colon, only message values are allowed.
+			err = p.parseList(name, true)
 		case Colon:
-			field, err = p.parseValueOrMessage(name)
+			err = p.parseValueOrMessage(name, tok == TypeName)
 		default:
-			return nil, p.fail("found %v, wanted %v or message", p.Token(), Colon)
+			return p.fail("found %v, wanted %v or message", p.Token(), Colon)
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if tok == TypeName && field.Values[0].Msg == nil {
-			return nil, p.fail("type name %q requires a message value", name)
-		}
-		msg = append(msg, field)
 		if tok := p.Token(); tok == Comma || tok == Semi {
 			p.Next() // skip optional separator
 		}
 	}
 }
 
-func (p parser) parseMessageField(name string, until Token) (*Field, error) {
+func (p parser) parseMessageField(until Token) error {
 	if !p.Next() {
-		return nil, p.fail("%v: wanted field or %v", p.Err(), until)
+		return p.fail("%v: wanted field or %v", p.Err(), until)
 	}
-	msg, err := p.parseMessage(until)
-	if err != nil {
-		return nil, err
+	if err := p.h.BeginMessage(); err != nil {
+		return err
+	} else if err := p.parseMessage(until); err != nil {
+		return err
 	}
 	if tok := p.Token(); tok != until {
-		return nil, p.fail("found %v, wanted %v", tok, until)
+		return p.fail("found %v, wanted %v", tok, until)
 	}
 	p.Next()
-	return &Field{
-		Name:   name,
-		Values: []*Value{{Msg: msg}},
-	}, nil
+	return p.h.EndMessage()
 }
 
-func (p parser) parseValueOrMessage(name string) (*Field, error) {
+func (p parser) parseValueOrMessage(name string, isType bool) error {
 	if !p.Next() {
-		return nil, p.fail("%v: wanted value or message for %q", p.Err(), name)
+		return p.fail("%v: wanted value or message for %q", p.Err(), name)
 	}
 	tok := p.Token()
 	if tok == LeftA {
-		return p.parseMessageField(name, RightA)
+		return p.parseMessageField(RightA)
 	} else if tok == LeftC {
-		return p.parseMessageField(name, RightC)
+		return p.parseMessageField(RightC)
+	} else if tok == LeftS {
+		return p.parseList(name, isType)
 	} else if !tok.IsValue() {
-		return nil, p.fail("unexpected %v, wanted a value", tok)
-	}
-	out := &Field{
-		Name: name,
-		Values: []*Value{{
-			Type: tok,
-			Text: p.Text(),
-		}},
+		return p.fail("unexpected %v, wanted a value", tok)
+	} else if isType {
+		return p.fail("type name %q requires a message value", name)
 	}
+	text := p.Text()
 
 	// Consecutive string literal tokens are concatenated.
 	for p.Next() {
 		if p.Token() == String && tok == String {
-			out.Values[0].Text += p.Text()
+			text += p.Text()
 			continue
 		}
 		break
 	}
-	return out, nil
+	return p.h.Value(tok, text)
+}
+
+// parseList parses the elements of a list, assuming the current token is the
+// opening bracket. The elements are values or messages separated by commas;
+// if msgOnly is true, they must all be messages.
+func (p parser) parseList(name string, msgOnly bool) error {
+	if !p.Next() {
+		return p.fail("%v: wanted value or %v", p.Err(), RightS)
+	}
+	for first := true; p.Token() != RightS; first = false {
+		// A comment on the line of the previous element belongs to it.
+		if err := p.comments(!first); err != nil {
+			return err
+		}
+		if !first {
+			if err := p.h.BeginField(name); err != nil {
+				return err
+			}
+		}
+		var err error
+		switch tok := p.Token(); {
+		case tok == LeftA:
+			err = p.parseMessageField(RightA)
+		case tok == LeftC:
+			err = p.parseMessageField(RightC)
+		case !tok.IsValue() || tok == TypeName:
+			return p.fail("unexpected %v, wanted a value", tok)
+		case msgOnly:
+			return p.fail("field %q requires a message value", name)
+		default:
+			err = p.h.Value(tok, p.Text())
+			p.Next()
+		}
+		if err != nil {
+			return err
+		}
+		if tok := p.Token(); tok == Comma {
+			p.Next()
+		} else if tok != RightS {
+			return p.fail("found %v, wanted %v or %v", tok, Comma, RightS)
+		}
+	}
+	p.Next()
+	return nil
+}
+
+// builder is a CommentHandler that constructs a Message from parse events.
+type builder struct {
+	stack []Message  // messages under construction
+	names []string   // field names for the messages on the stack
+	leads [][]string // leading comments for the fields named in names
+	name  string     // the name of the current field
+	lead  []string   // leading comments for the current field
+	notes []string   // comments not yet attached to a field
+	root  Message    // the completed top-level message
+}
+
+func (b *builder) BeginMessage() error {
+	b.stack = append(b.stack, Message{}) // not nil, as that is the signal for a primitive
+	b.names = append(b.names, b.name)
+	b.leads = append(b.leads, append(b.lead, b.notes...))
+	b.lead, b.notes = nil, nil
+	return nil
+}
+
+func (b *builder) EndMessage() error {
+	n := len(b.stack) - 1
+	msg, name, lead := b.stack[n], b.names[n], b.leads[n]
+	b.stack, b.names, b.leads = b.stack[:n], b.names[:n], b.leads[:n]
+
+	// Comments at the end of the message belong to its last field, if any,
+	// and otherwise are kept inside the enclosing field.
+	inner := b.notes
+	b.notes = nil
+	if len(msg) != 0 {
+		last := msg[len(msg)-1]
+		last.Trailing = append(last.Trailing, inner...)
+		inner = nil
+	}
+	if n == 0 {
+		b.root = msg
+	} else {
+		b.add(&Field{Name: name, Values: []*Value{{Msg: msg}}, Comments: lead, Inner: inner})
+	}
+	return nil
+}
+
+func (b *builder) BeginField(name string) error {
+	b.name, b.lead, b.notes = name, b.notes, nil
+	return nil
+}
+
+func (b *builder) Value(tok Token, text string) error {
+	// Comments between the name and the value also precede the field.
+	b.add(&Field{Name: b.name, Values: []*Value{{Type: tok, Text: text}}, Comments: append(b.lead, b.notes...)})
+	b.lead, b.notes = nil, nil
+	return nil
+}
+
+func (b *builder) LineComment(text string) error {
+	if msg := b.stack[len(b.stack)-1]; len(msg) != 0 {
+		msg[len(msg)-1].LineComment = text
+	}
+	return nil
+}
+
+func (b *builder) Comments(text []string) error {
+	b.notes = append(b.notes, text...)
+	return nil
+}
+
+func (b *builder) add(f *Field) {
+	n := len(b.stack) - 1
+	b.stack[n] = append(b.stack[n], f)
 }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func pathValue(m Message, path string) (*Value, error) {
@@ -51,6 +53,9 @@ func TestParse(t *testing.T) {
 		{`a < n:1 s:"two" > b { n:2 s:false}`, "a.s", "two"},
 		{`a: < b <> c: false d < [x]: { y:1 } >>`, "a.d.x.y", "1"},
 		{`a:1, b:2; c < d < e:3, > >;`, "c.d.e", "3"},
+		{`a: [1, 2] b: [] c [{d: 4}, <d: 5>,]`, "c.d", "4"},
+		{`a: [1] b: [FOO]`, "b", "FOO"},
+		{`a: FOO [ext] { z: 2 }`, "ext.z", "2"},
 		{`# Pearls and swine
 bereft: "of" ' me'
 
@@ -91,7 +96,13 @@ func TestParseErrors(t *testing.T) {
 		"a <", "a: >", "a {", "a: }", "a: '", `a: "`,
 
 		// Type names require message values
-		"[a/b/c]: wrong",
+		"[a/b/c]: wrong", "[a/b/c]: [wrong]",
+
+		// Malformed lists
+		"[whatcha gonna do]", "a: [1 2]", "a: [1,", "a: [:]", "a [b]", "a: [1, [b]]", "a: [[b]]",
+
+		// Scanning errors after the first token
+		"a: 1 ?", "a { b: 'c }",
 	}
 	for _, test := range tests {
 		got, err := Parse(strings.NewReader(test))
@@ -102,3 +113,103 @@ func TestParseErrors(t *testing.T) {
 		t.Logf("Parse %q OK: got error %v", test, err)
 	}
 }
+
+func TestParseComments(t *testing.T) {
+	const input = `# head
+a: 1 # line a
+b { # in b
+  # lead c
+  c: 2
+  # end of b
+} # line b
+d {
+  # in d
+}
+# tail`
+	msg, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	type comments struct {
+		Name     string
+		Lead     []string
+		Line     string
+		Trailing []string
+		Inner    []string
+	}
+	var got []comments
+	if err := Walk(msg, VisitFuncs{
+		Field: func(_ string, f *Field) error {
+			got = append(got, comments{f.Name, f.Comments, f.LineComment, f.Trailing, f.Inner})
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	want := []comments{
+		{Name: "a", Lead: []string{" head"}, Line: " line a"},
+		{Name: "b", Line: " line b"},
+		{Name: "c", Lead: []string{" in b", " lead c"}, Trailing: []string{" end of b"}},
+		{Name: "d", Trailing: []string{" tail"}, Inner: []string{" in d"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Comments (-want, +got):\n%s", diff)
+	}
+}
+
+func TestParseListComments(t *testing.T) {
+	msg, err := ParseString(`a: [1, # one
+  # lead two
+  2, # two
+  3]
+b: [ # first
+  {c: 1}, # c1
+  {}
+] # after b
+d: # note d
+  4`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	type comments struct {
+		Text string
+		Lead []string
+		Line string
+	}
+	var got []comments
+	for _, f := range msg {
+		text := f.Values[0].Text
+		if f.Values[0].Msg != nil {
+			text = fmt.Sprintf("{%d fields}", len(f.Values[0].Msg))
+		}
+		got = append(got, comments{f.Name + "=" + text, f.Comments, f.LineComment})
+	}
+	want := []comments{
+		{Text: "a=1", Line: " one"},
+		{Text: "a=2", Lead: []string{" lead two"}, Line: " two"},
+		{Text: "a=3"},
+		{Text: "b={1 fields}", Lead: []string{" first"}, Line: " c1"},
+		{Text: "b={0 fields}", Line: " after b"},
+		{Text: "d=4", Line: " note d"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Comments (-want, +got):\n%s", diff)
+	}
+}
+
+func TestParseLists(t *testing.T) {
+	msg, err := ParseString(`a: [1, "two", THREE] b [{c: 1}, {c: 2}] d: []`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := Message{
+		{Name: "a", Values: []*Value{{Type: Number, Text: "1"}}},
+		{Name: "a", Values: []*Value{{Type: String, Text: "two"}}},
+		{Name: "a", Values: []*Value{{Type: Name, Text: "THREE"}}},
+		{Name: "b", Values: []*Value{{Msg: Message{{Name: "c", Values: []*Value{{Type: Number, Text: "1"}}}}}}},
+		{Name: "b", Values: []*Value{{Msg: Message{{Name: "c", Values: []*Value{{Type: Number, Text: "2"}}}}}}},
+	}
+	if diff := cmp.Diff(want, msg); diff != "" {
+		t.Errorf("Parse (-want, +got):\n%s", diff)
+	}
+}
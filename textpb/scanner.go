@@ -5,10 +5,13 @@ package textpb
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // A Token represents the lexical type of tokens returned by the scanner.
@@ -30,12 +33,14 @@ const (
 	RightC         // right curly bracket
 	Comma          // comma
 	Semi           // semicolon
+	LeftS          // left square bracket
+	RightS         // right square bracket
 
 	// These are whitespace characters.
 	whiteSpace = " \t\r\n"
 
 	// These are delimiters for a name-like token.
-	nameDelim = whiteSpace + `<>{}:'",;`
+	nameDelim = whiteSpace + `<>{}[]:'",;`
 )
 
 func (t Token) String() string { return tokenString[t] }
@@ -53,9 +58,13 @@ var selfToken = map[rune]Token{
 	'}': RightC,
 	',': Comma,
 	';': Semi,
+	']': RightS,
 }
 
-var escapeCode = map[rune]rune{'r': '\r', 'n': '\n', 't': '\t', '\\': '\\'}
+var escapeCode = map[rune]rune{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+	'\\': '\\', '\'': '\'', '"': '"', '?': '?',
+}
 
 var tokenString = map[Token]string{
 	None:     "<none>",
@@ -72,10 +81,13 @@ var tokenString = map[Token]string{
 	RightC:   `"}"`,
 	Comma:    `","`,
 	Semi:     `";"`,
+	LeftS:    `"["`,
+	RightS:   `"]"`,
 }
 
 var isFixed = regexp.MustCompile(`(?i)^-?0x[a-f0-9]+$`)
 var isFloat = regexp.MustCompile(`(?i)^-?(\d+(\.\d*)?|\.\d+)(e[-+]?\d+)?f?$`)
+var isNegInf = regexp.MustCompile(`(?i)^-inf(inity)?$`)
 var isName = regexp.MustCompile(`(?i)^[_a-z][_a-z0-9]*$`)
 
 func isSpace(c rune) bool { return strings.ContainsRune(whiteSpace, c) }
@@ -92,6 +104,11 @@ type Scanner struct {
 	lnum     int   // line number (0-based)
 	err      error // error from previous operation
 	cur      bytes.Buffer
+
+	notes  []string // comments skipped since the last call to Comments
+	inline bool     // whether notes[0] is on the line of the token before it
+	nl     bool     // whether a newline has been skipped since the last token
+	seen   bool     // whether any token has been scanned
 }
 
 // Token returns the type of the current token.
@@ -112,7 +129,16 @@ func (s *Scanner) Line() int { return s.lnum + 1 }
 // Text returns the text of the current token.
 func (s *Scanner) Text() string { return s.cur.String() }
 
-func (s *Scanner) ok(tok Token) bool   { s.tok = tok; return true }
+// Comments returns the text of the comments skipped by the scanner since the
+// previous call to Comments, without their leading "#", and reports whether
+// the first of them began on the same line as the token before it.
+func (s *Scanner) Comments() (text []string, inline bool) {
+	text, inline = s.notes, s.inline
+	s.notes, s.inline = nil, false
+	return text, inline
+}
+
+func (s *Scanner) ok(tok Token) bool   { s.tok = tok; s.seen = true; return true }
 func (s *Scanner) fail(err error) bool { s.err = err; return false }
 
 // Next advances the scanner to the next token and reports whether any token
@@ -122,8 +148,10 @@ func (s *Scanner) Next() bool {
 	if s.err != nil {
 		return false
 	}
+	prev := s.tok
 	s.tok = None
 	s.pos = s.end
+	s.nl = false
 	s.cur.Reset()
 
 	c, err := s.skipSpace()
@@ -133,7 +161,11 @@ func (s *Scanner) Next() bool {
 	if c == '"' || c == '\'' {
 		return s.quotedString(c)
 	} else if c == '[' {
-		return s.typeName()
+		if namePosition(prev) {
+			return s.typeName()
+		}
+		s.cur.WriteByte('[')
+		return s.ok(LeftS)
 	}
 	s.cur.WriteRune(c)
 
@@ -166,7 +198,7 @@ func (s *Scanner) nameLike(init rune) bool {
 		return s.ok(True)
 	} else if cur == "false" {
 		return s.ok(False)
-	} else if isFixed.MatchString(cur) || isFloat.MatchString(cur) {
+	} else if isFixed.MatchString(cur) || isFloat.MatchString(cur) || isNegInf.MatchString(cur) {
 		return s.ok(Number)
 	} else if isName.MatchString(cur) {
 		return s.ok(Name)
@@ -174,28 +206,59 @@ func (s *Scanner) nameLike(init rune) bool {
 	return s.fail(fmt.Errorf("invalid token %q", cur))
 }
 
+// namePosition reports whether a token following prev can only be a field
+// name, so that a left square bracket there begins an extension or type name
+// rather than a list. After a name or a keyword, which may be either a field
+// name or a value, the scanner reports a bracket as LeftS, and a parser that
+// expects a field name there calls ScanTypeName.
+func namePosition(prev Token) bool {
+	switch prev {
+	case None, LeftA, LeftC, RightA, RightC, RightS, Comma, Semi, Number, String:
+		return true
+	}
+	return false
+}
+
+// ScanTypeName rescans the current token, which must be LeftS, as the opening
+// bracket of an extension or type name, and reports whether one was found.
+func (s *Scanner) ScanTypeName() bool {
+	if s.err != nil || s.tok != LeftS {
+		return false
+	}
+	s.cur.Reset()
+	return s.typeName()
+}
+
 // typeName scans a string bounded by square brackets, assuming the leading
-// bracket has already been read. On success the token text excludes the
+// bracket has already been read. The string may contain only letters, digits,
+// underscores, dots, and slashes. On success the token text excludes the
 // brackets.
 func (s *Scanner) typeName() bool {
 	for {
 		c, n, err := s.r.ReadRune()
-		if err != nil {
+		if err == io.EOF {
+			return s.fail(errors.New("missing ']' in type name"))
+		} else if err != nil {
 			return s.fail(err)
 		}
 		s.end += n
-		if c == ']' {
+		if c == ']' && s.cur.Len() != 0 {
 			return s.ok(TypeName)
-		} else if isDelim(c) {
+		} else if !isTypeNameRune(c) {
 			return s.fail(fmt.Errorf("unexpected %q in type name", c))
 		}
 		s.cur.WriteRune(c)
 	}
 }
 
+func isTypeNameRune(c rune) bool {
+	return c == '_' || c == '.' || c == '/' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
 // quotedString scans a string bounded by quote, assuming the leading quote has
 // already been read. On success the token text excludes the quotes and escape
-// sequences have been folded out.
+// sequences have been folded out. Bytes that are not valid UTF-8 are kept as
+// written.
 func (s *Scanner) quotedString(quote rune) bool {
 	esc := false
 	for {
@@ -210,22 +273,87 @@ func (s *Scanner) quotedString(quote rune) bool {
 			return s.fail(fmt.Errorf("unexpected %q in string", c))
 		} else if esc {
 			esc = false
-			if sub, ok := escapeCode[c]; ok {
-				s.cur.WriteRune(sub)
-				continue
-			} else if c != quote {
-				s.cur.WriteRune('\\')
+			if err := s.escape(c); err != nil {
+				return s.fail(err)
 			}
+			continue
 		} else if c == '\\' {
 			esc = true
 			continue
 		} else if c == quote {
 			return s.ok(String)
+		} else if c == utf8.RuneError && n == 1 {
+			s.r.UnreadRune()
+			b, _ := s.r.ReadByte()
+			s.cur.WriteByte(b)
+			continue
 		}
 		s.cur.WriteRune(c)
 	}
 }
 
+// escape decodes the escape sequence that begins with c following a backslash.
+// The C escapes are supported, along with octal (\ooo), hexadecimal (\xhh),
+// and Unicode (\uhhhh, \Uhhhhhhhh) escapes. Unrecognized sequences are kept
+// as written.
+func (s *Scanner) escape(c rune) error {
+	if sub, ok := escapeCode[c]; ok {
+		s.cur.WriteRune(sub)
+		return nil
+	}
+	switch c {
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		v, n, err := s.digits(8, 2)
+		if err != nil {
+			return err
+		}
+		v += uint64(c-'0') << (3 * n)
+		if v > 0xff {
+			return fmt.Errorf("octal escape \\%o out of range", v)
+		}
+		s.cur.WriteByte(byte(v))
+		return nil
+	case 'x', 'X', 'u', 'U':
+		size := map[rune]int{'x': 2, 'X': 2, 'u': 4, 'U': 8}[c]
+		v, n, err := s.digits(16, size)
+		if err != nil {
+			return err
+		} else if n == 0 || (c == 'u' || c == 'U') && n != size {
+			return fmt.Errorf("invalid \\%c escape", c)
+		} else if c == 'x' || c == 'X' {
+			s.cur.WriteByte(byte(v))
+		} else if v > unicode.MaxRune || (v >= 0xd800 && v < 0xe000) {
+			return fmt.Errorf("invalid code point %#x in escape", v)
+		} else {
+			s.cur.WriteRune(rune(v))
+		}
+		return nil
+	}
+	s.cur.WriteRune('\\')
+	s.cur.WriteRune(c)
+	return nil
+}
+
+// digits reads up to max digits in the given base, and returns their value
+// and the number of digits read.
+func (s *Scanner) digits(base, max int) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < max; i++ {
+		c, n, err := s.r.ReadRune()
+		if err != nil {
+			return 0, 0, err
+		}
+		d := strings.IndexRune("0123456789abcdef"[:base], unicode.ToLower(c))
+		if d < 0 {
+			s.r.UnreadRune()
+			return v, i, nil
+		}
+		s.end += n
+		v = v*uint64(base) + uint64(d)
+	}
+	return v, max, nil
+}
+
 // skipSpace discards whitespace and returns the first non-space byte.
 func (s *Scanner) skipSpace() (rune, error) {
 	for {
@@ -236,19 +364,36 @@ func (s *Scanner) skipSpace() (rune, error) {
 		s.end += n
 		if c == '\n' {
 			s.lnum++
+			s.nl = true
 		}
 		if c == '#' {
-			for c != '\n' {
+			var text strings.Builder
+			for {
 				c, n, err = s.r.ReadRune()
 				if err != nil {
+					s.note(text.String())
 					return 0, err
 				}
 				s.end += n
+				if c == '\n' {
+					break
+				}
+				text.WriteRune(c)
 			}
+			s.note(text.String())
 			s.lnum++
+			s.nl = true
 		} else if !isSpace(c) {
 			s.pos = s.end
 			return c, nil
 		}
 	}
 }
+
+// note records the text of a comment.
+func (s *Scanner) note(text string) {
+	if len(s.notes) == 0 {
+		s.inline = s.seen && !s.nl
+	}
+	s.notes = append(s.notes, strings.TrimRight(text, whiteSpace))
+}
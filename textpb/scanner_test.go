@@ -28,12 +28,20 @@ func TestScanner(t *testing.T) {
 		}},
 		{`"mültípàss" 'lεveρbøt' KOOL`, []Token{String, String, Name}},
 		{`kind: CALL`, []Token{Name, Colon, Name}},
+		{`a: [1, x] b: [] c [{}] d: [FOO] e: ['u'] [x.y/Z] {}`, []Token{
+			Name, Colon, LeftS, Number, Comma, Name, RightS,
+			Name, Colon, LeftS, RightS,
+			Name, LeftS, LeftC, RightC, RightS,
+			Name, Colon, LeftS, Name, RightS,
+			Name, Colon, LeftS, String, RightS, TypeName, LeftC, RightC,
+		}},
 		{`[grok.proto.Foo] { value: 27 weight: .2 }`, []Token{
 			TypeName, LeftC, Name, Colon, Number, Name, Colon, Number, RightC,
 		}},
 		{`1 2. .3 -.4 5e16 -6e+9 .70E-1 88.81 11f -.5e-2f`, []Token{
 			Number, Number, Number, Number, Number, Number, Number, Number, Number, Number,
 		}},
+		{`inf -inf -Infinity nan`, []Token{Name, Number, Number, Name}},
 		{`decorations < outline:true source_text:false > ticket: "bogus"`, []Token{
 			Name, LeftA, Name, Colon, True, Name, Colon, False, RightA, Name, Colon, String,
 		}},
@@ -59,9 +67,11 @@ func TestScanErrors(t *testing.T) {
 		"'bad\nstring'",
 		`'whatcha gonna do`,
 		`[whatcha gonna do]`,
+		`[whatcha_gonna_do`,
 		`when/they^come%for&you`,
 		`?`,
 		`-`, `.`, `.-9`, `2^&#$^@#$`,
+		`"\400"`, `"\xq"`, `"\u12"`, `"\ud800"`, `"\U00110000"`,
 	}
 	for _, test := range tests {
 		s := NewScanner(strings.NewReader(test))
@@ -74,3 +84,55 @@ func TestScanErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestScanStrings(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`""`, ""},
+		{`"a\tb\nc"`, "a\tb\nc"},
+		{`'it\'s'`, "it's"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"\a\b\f\v\?\\"`, "\a\b\f\v?\\"},
+		{`"\0\12\101\1012"`, "\x00\nAA2"},
+		{`"\377\x7f\xA"`, "\xff\x7f\n"},
+		{`"\u00e9\U0001F600"`, "é😀"},
+		{`"\q"`, `\q`}, // unrecognized escapes are preserved
+		{"\"raw \xfe byte\"", "raw \xfe byte"},
+	}
+	for _, test := range tests {
+		s := NewScanner(strings.NewReader(test.input))
+		if !s.Next() {
+			t.Errorf("Scan %#q: unexpected error: %v", test.input, s.Err())
+		} else if s.Token() != String {
+			t.Errorf("Scan %#q: got token %v, want %v", test.input, s.Token(), String)
+		} else if got := s.Text(); got != test.want {
+			t.Errorf("Scan %#q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	s := NewScanner(strings.NewReader("# one\n#two  \na # three\n# four\nb\n# five"))
+	type result struct {
+		Text   []string
+		Inline bool
+	}
+	var got []result
+	for {
+		ok := s.Next()
+		text, inline := s.Comments()
+		got = append(got, result{text, inline})
+		if !ok {
+			break
+		}
+	}
+	want := []result{
+		{[]string{" one", "two"}, false},
+		{[]string{" three", " four"}, true},
+		{[]string{" five"}, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Comments: got %+v, want %+v", got, want)
+	}
+}
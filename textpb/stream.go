@@ -0,0 +1,118 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// A JSONWriter is a Handler that writes JSON to an io.Writer as a message is
+// parsed by Stream, without constructing the message in memory. The output
+// is the same as the encoding of the message Parse would return; since the
+// fields are not combined, a field that occurs more than once in the input
+// produces multiple members with the same name.
+type JSONWriter struct {
+	w      *bufio.Writer
+	opts   JSONOptions
+	prefix string
+	indent string
+	name   string      // the name of the current field
+	stack  []jsonFrame // objects currently open
+}
+
+// A jsonFrame records the state of an open JSON object.
+type jsonFrame struct {
+	depth  int  // indentation level for members
+	empty  bool // no members have been written yet
+	inline bool // an expanded Any merged into its enclosing object
+}
+
+// NewJSONWriter returns a JSONWriter that writes to w using opts.
+func NewJSONWriter(w io.Writer, opts JSONOptions) *JSONWriter {
+	return &JSONWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+// SetIndent instructs the writer to format its output with each member on a
+// separate line, as with the SetIndent method of json.Encoder.
+func (j *JSONWriter) SetIndent(prefix, indent string) { j.prefix, j.indent = prefix, indent }
+
+// BeginMessage implements part of the Handler interface.
+func (j *JSONWriter) BeginMessage() error {
+	n := len(j.stack)
+	if n == 0 {
+		j.w.WriteByte('{')
+		j.stack = append(j.stack, jsonFrame{depth: 1, empty: true})
+		return nil
+	}
+	depth := j.stack[n-1].depth
+	j.member()
+	if j.opts.ExpandAny && isTypeURL(j.name) {
+		j.key("@type")
+		writeJSONString(j.w, j.name)
+		j.stack = append(j.stack, jsonFrame{depth: depth, inline: true})
+		return nil
+	}
+	j.key(j.opts.fieldName(j.name))
+	j.w.WriteByte('{')
+	j.stack = append(j.stack, jsonFrame{depth: depth + 1, empty: true})
+	return nil
+}
+
+// EndMessage implements part of the Handler interface.
+func (j *JSONWriter) EndMessage() error {
+	n := len(j.stack) - 1
+	top := j.stack[n]
+	j.stack = j.stack[:n]
+	if top.inline {
+		return nil
+	}
+	if !top.empty {
+		j.newline(top.depth - 1)
+	}
+	j.w.WriteByte('}')
+	if n == 0 {
+		j.w.WriteByte('\n')
+		return j.w.Flush()
+	}
+	return nil
+}
+
+// BeginField implements part of the Handler interface.
+func (j *JSONWriter) BeginField(name string) error { j.name = name; return nil }
+
+// Value implements part of the Handler interface.
+func (j *JSONWriter) Value(tok Token, text string) error {
+	j.member()
+	j.key(j.opts.fieldName(j.name))
+	return j.opts.marshalValue(j.w, &Value{Type: tok, Text: text})
+}
+
+// member writes the separator and indentation preceding a new member of the
+// innermost open object.
+func (j *JSONWriter) member() {
+	top := &j.stack[len(j.stack)-1]
+	if !top.empty {
+		j.w.WriteByte(',')
+	}
+	top.empty = false
+	j.newline(top.depth)
+}
+
+// key writes an object key and the following colon.
+func (j *JSONWriter) key(name string) {
+	writeJSONString(j.w, name)
+	j.w.WriteByte(':')
+	if j.indent != "" || j.prefix != "" {
+		j.w.WriteByte(' ')
+	}
+}
+
+func (j *JSONWriter) newline(depth int) {
+	if j.indent != "" || j.prefix != "" {
+		j.w.WriteByte('\n')
+		j.w.WriteString(j.prefix)
+		j.w.WriteString(strings.Repeat(j.indent, depth))
+	}
+}
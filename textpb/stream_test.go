@@ -0,0 +1,66 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONWriter(t *testing.T) {
+	tests := []string{
+		"",
+		"a:1",
+		"a:1 a:2 b:'three' 'four'",
+		"a <> b {} c: { d: true }",
+		"a < b < c: FOO > d: -inf > e: 18446744073709551616",
+		"x { [type.googleapis.com/foo.Bar] { y: 1 z { w: 2 } } } v: 3",
+		"[pkg.ext]: { some_name: 0x10 }",
+	}
+	opts := []JSONOptions{{}, Proto3JSON}
+	for _, input := range tests {
+		msg, err := ParseString(input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", input, err)
+		}
+		for _, opt := range opts {
+			want, err := opt.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Marshal %q failed: %v", input, err)
+			}
+			var pretty bytes.Buffer
+			if err := json.Indent(&pretty, want, "", "  "); err != nil {
+				t.Fatalf("Indent %q failed: %v", want, err)
+			}
+
+			var flat, indented bytes.Buffer
+			if err := Stream(strings.NewReader(input), NewJSONWriter(&flat, opt)); err != nil {
+				t.Errorf("Stream %q: unexpected error: %v", input, err)
+				continue
+			}
+			if got := strings.TrimSuffix(flat.String(), "\n"); got != string(want) {
+				t.Errorf("Stream %q: got %s, want %s", input, got, want)
+			}
+
+			jw := NewJSONWriter(&indented, opt)
+			jw.SetIndent("", "  ")
+			if err := Stream(strings.NewReader(input), jw); err != nil {
+				t.Errorf("Stream %q: unexpected error: %v", input, err)
+			} else if got := strings.TrimSuffix(indented.String(), "\n"); got != pretty.String() {
+				t.Errorf("Stream %q indented: got\n%s\nwant\n%s", input, got, pretty.String())
+			}
+		}
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	tests := []string{"a <", "a: }", "a: 1 ?", "[a/b]: 1"}
+	for _, input := range tests {
+		var buf bytes.Buffer
+		if err := Stream(strings.NewReader(input), NewJSONWriter(&buf, JSONOptions{})); err == nil {
+			t.Errorf("Stream %q: got %q, wanted error", input, buf.String())
+		}
+	}
+}
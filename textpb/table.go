@@ -0,0 +1,172 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+// This file adds flattening of messages into tabular form.
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FlattenOptions control the representation of repeated fields by Flatten.
+type FlattenOptions struct {
+	// If Join is non-empty, the values of a repeated field share a single
+	// column, and their text is joined with this separator. Otherwise each
+	// value has its own column, whose path is suffixed with the index of the
+	// value, e.g., "a.0", "a.1".
+	Join string
+}
+
+// A Cell is one column of a flattened message.
+type Cell struct {
+	Path string // the path of the column, as constructed by JoinPath
+	Text string // the text of the value
+}
+
+// Flatten returns the primitive values of m, including those of nested
+// messages, as a sequence of cells in order of occurrence. Fields with the
+// same name are combined first. A nested message with no fields is given a
+// cell with empty text, so that its column is not lost.
+func (m Message) Flatten(opts FlattenOptions) []Cell {
+	var cells []Cell
+	for _, f := range m.Combine() {
+		cells = append(cells, f.flatten("", opts)...)
+	}
+	return cells
+}
+
+func (f *Field) flatten(path string, opts FlattenOptions) []Cell {
+	path = JoinPath(path, f.Name)
+	if len(f.Values) == 1 {
+		return f.Values[0].flatten(path, opts)
+	}
+	var cells []Cell
+	for i, v := range f.Values {
+		if opts.Join == "" {
+			cells = append(cells, v.flatten(path+"."+strconv.Itoa(i), opts)...)
+		} else {
+			cells = append(cells, v.flatten(path, opts)...)
+		}
+	}
+	if opts.Join == "" {
+		return cells
+	}
+
+	// Join the text of cells that share a path, in order of first occurrence.
+	var joined []Cell
+	pos := make(map[string]int)
+	for _, c := range cells {
+		if i, ok := pos[c.Path]; ok {
+			joined[i].Text += opts.Join + c.Text
+		} else {
+			pos[c.Path] = len(joined)
+			joined = append(joined, c)
+		}
+	}
+	return joined
+}
+
+func (v *Value) flatten(path string, opts FlattenOptions) []Cell {
+	if v.Msg == nil {
+		return []Cell{{Path: path, Text: v.Text}}
+	} else if len(v.Msg) == 0 {
+		return []Cell{{Path: path}}
+	}
+	var cells []Cell
+	for _, f := range v.Msg {
+		cells = append(cells, f.flatten(path, opts)...)
+	}
+	return cells
+}
+
+// A Table accumulates flattened messages as rows. The columns of the table
+// are the union of the columns of its rows, in order of first occurrence.
+type Table struct {
+	opts    FlattenOptions
+	columns []string
+	index   map[string]int // column path → offset in columns
+	rows    []map[string]string
+}
+
+// NewTable constructs an empty table that flattens messages using opts.
+func NewTable(opts FlattenOptions) *Table {
+	return &Table{opts: opts, index: make(map[string]int)}
+}
+
+// Add flattens m and adds it to t as a new row.
+func (t *Table) Add(m Message) {
+	row := make(map[string]string)
+	for _, c := range m.Flatten(t.opts) {
+		if _, ok := t.index[c.Path]; !ok {
+			t.index[c.Path] = len(t.columns)
+			t.columns = append(t.columns, c.Path)
+		}
+		row[c.Path] = c.Text
+	}
+	t.rows = append(t.rows, row)
+}
+
+// Columns returns the column paths of t.
+func (t *Table) Columns() []string { return t.columns }
+
+// Len reports the number of rows in t.
+func (t *Table) Len() int { return len(t.rows) }
+
+// WriteCSV writes t to w in CSV format as described by RFC 4180, using comma
+// as the field delimiter. Fields are quoted as by encoding/csv, and records
+// end with CRLF. The first record is a header giving the column paths. Cells
+// missing from a row are written as empty fields.
+func (t *Table) WriteCSV(w io.Writer, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.UseCRLF = true
+	if err := cw.Write(t.columns); err != nil {
+		return err
+	}
+	rec := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, col := range t.columns {
+			rec[i] = row[col]
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tsvEscaper escapes the characters that cannot appear in a TSV field.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// WriteTSV writes t to w in tab-separated format. Fields are not quoted;
+// instead tabs, newlines, carriage returns, and backslashes in a field are
+// written as the escapes \t, \n, \r, and \\. Records end with a newline. As
+// for WriteCSV, the first record is a header giving the column paths, and
+// cells missing from a row are written as empty fields.
+func (t *Table) WriteTSV(w io.Writer) error {
+	rec := make([]string, len(t.columns))
+	write := func(fields []string) error {
+		for i, f := range fields {
+			rec[i] = tsvEscaper.Replace(f)
+		}
+		_, err := io.WriteString(w, strings.Join(rec, "\t")+"\n")
+		return err
+	}
+	if err := write(t.columns); err != nil {
+		return err
+	}
+	fields := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, col := range t.columns {
+			fields[i] = row[col]
+		}
+		if err := write(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFlatten(t *testing.T) {
+	const input = `name: "x" tag: A tag: B
+loc { lat: 1.5 lng: 2 }
+item { id: 1 } item { id: 2 note: "n" }
+empty {}`
+	msg, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tests := []struct {
+		opts FlattenOptions
+		want []Cell
+	}{
+		{FlattenOptions{}, []Cell{
+			{"empty", ""},
+			{"item.0.id", "1"}, {"item.1.id", "2"}, {"item.1.note", "n"},
+			{"loc.lat", "1.5"}, {"loc.lng", "2"},
+			{"name", "x"},
+			{"tag.0", "A"}, {"tag.1", "B"},
+		}},
+		{FlattenOptions{Join: "|"}, []Cell{
+			{"empty", ""},
+			{"item.id", "1|2"}, {"item.note", "n"},
+			{"loc.lat", "1.5"}, {"loc.lng", "2"},
+			{"name", "x"},
+			{"tag", "A|B"},
+		}},
+	}
+	for _, test := range tests {
+		got := msg.Flatten(test.opts)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Flatten %+v (-want, +got):\n%s", test.opts, diff)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	msg, err := ParseString(`a: 1 r { b: "x,y" c: 2 } r { b: "say \"hi\"" d: 3 }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tab := NewTable(FlattenOptions{})
+	for _, m := range msg.SplitOn("r") {
+		tab.Add(m)
+	}
+	if got, want := tab.Len(), 2; got != want {
+		t.Errorf("Len: got %d, want %d", got, want)
+	}
+
+	var csv, tsv strings.Builder
+	if err := tab.WriteCSV(&csv, ','); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	if err := tab.WriteTSV(&tsv); err != nil {
+		t.Fatalf("WriteTSV failed: %v", err)
+	}
+	if diff := cmp.Diff("a,r.b,r.c,r.d\r\n1,\"x,y\",2,\r\n1,\"say \"\"hi\"\"\",,3\r\n", csv.String()); diff != "" {
+		t.Errorf("CSV (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("a\tr.b\tr.c\tr.d\n1\tx,y\t2\t\n1\tsay \"hi\"\t\t3\n", tsv.String()); diff != "" {
+		t.Errorf("TSV (-want, +got):\n%s", diff)
+	}
+}
+
+func TestTableTSVEscapes(t *testing.T) {
+	tab := NewTable(FlattenOptions{})
+	tab.Add(Message{{Name: "a", Values: []*Value{{Type: String, Text: "x\ty\nz\r\\"}}}})
+	var buf strings.Builder
+	if err := tab.WriteTSV(&buf); err != nil {
+		t.Fatalf("WriteTSV failed: %v", err)
+	}
+	if diff := cmp.Diff("a\n"+`x\ty\nz\r\\`+"\n", buf.String()); diff != "" {
+		t.Errorf("TSV (-want, +got):\n%s", diff)
+	}
+}
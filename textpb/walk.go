@@ -0,0 +1,157 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+// This file adds traversal of messages.
+
+import (
+	"errors"
+	"iter"
+	"strings"
+)
+
+// SkipChildren may be returned by the Enter methods of a Visitor to indicate
+// that Walk should not descend into the current message, field, or value.
+// It is not returned as an error by Walk.
+var SkipChildren = errors.New("skip children")
+
+// A Visitor receives callbacks from Walk. Each method is given the path of
+// the current location in the message, which is empty at the top level, and
+// has the form "a.b.c" for the value of field c in message b in message a.
+// If a method reports an error other than SkipChildren, Walk stops and
+// returns that error.
+type Visitor interface {
+	// EnterMessage is called before visiting the fields of m. If it returns
+	// SkipChildren, the fields of m are skipped and LeaveMessage is not called.
+	EnterMessage(path string, m Message) error
+
+	// EnterField is called before visiting the values of f.
+	EnterField(path string, f *Field) error
+
+	// EnterValue is called for each value v. The visitor may modify *v in
+	// place to replace the value; Walk visits the message in v.Msg, if any,
+	// after EnterValue returns.
+	EnterValue(path string, v *Value) error
+
+	// LeaveMessage is called after the fields of m have been visited.
+	LeaveMessage(path string, m Message) error
+}
+
+// VisitFuncs implements the Visitor interface by calling the corresponding
+// functions. Any function that is nil is treated as returning nil.
+type VisitFuncs struct {
+	Message func(path string, m Message) error
+	Field   func(path string, f *Field) error
+	Value   func(path string, v *Value) error
+	Leave   func(path string, m Message) error
+}
+
+// EnterMessage implements part of the Visitor interface.
+func (v VisitFuncs) EnterMessage(path string, m Message) error { return call(v.Message, path, m) }
+
+// EnterField implements part of the Visitor interface.
+func (v VisitFuncs) EnterField(path string, f *Field) error { return call(v.Field, path, f) }
+
+// EnterValue implements part of the Visitor interface.
+func (v VisitFuncs) EnterValue(path string, val *Value) error { return call(v.Value, path, val) }
+
+// LeaveMessage implements part of the Visitor interface.
+func (v VisitFuncs) LeaveMessage(path string, m Message) error { return call(v.Leave, path, m) }
+
+func call[T any](f func(string, T) error, path string, arg T) error {
+	if f == nil {
+		return nil
+	}
+	return f(path, arg)
+}
+
+// Walk traverses msg in depth-first order, calling the methods of v for each
+// message, field, and value.
+func Walk(msg Message, v Visitor) error {
+	err := walkMessage("", msg, v)
+	if err == SkipChildren {
+		return nil
+	}
+	return err
+}
+
+func walkMessage(path string, msg Message, v Visitor) error {
+	if err := v.EnterMessage(path, msg); err != nil {
+		return err
+	}
+	for _, f := range msg {
+		fpath := JoinPath(path, f.Name)
+		if err := v.EnterField(fpath, f); err == SkipChildren {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, val := range f.Values {
+			if err := v.EnterValue(fpath, val); err == SkipChildren {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if val.Msg == nil {
+				continue
+			} else if err := walkMessage(fpath, val.Msg, v); err != nil && err != SkipChildren {
+				return err
+			}
+		}
+	}
+	return v.LeaveMessage(path, msg)
+}
+
+// All returns an iterator over the values of m and its nested messages in
+// depth-first order, paired with their paths as described for Visitor.
+// A repeated field yields the same path once for each of its values.
+func (m Message) All() iter.Seq2[string, *Value] {
+	return func(yield func(string, *Value) bool) { allValues("", m, yield) }
+}
+
+func allValues(path string, m Message, yield func(string, *Value) bool) bool {
+	for _, f := range m {
+		fpath := JoinPath(path, f.Name)
+		for _, v := range f.Values {
+			if !yield(fpath, v) {
+				return false
+			} else if v.Msg != nil && !allValues(fpath, v.Msg, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// JoinPath returns the path of the field with the given name inside the
+// message at path. A name that is not a plain identifier, such as an
+// extension or a type URL, is enclosed in square brackets.
+func JoinPath(path, name string) string {
+	if !isName.MatchString(name) {
+		name = "[" + name + "]"
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// SplitPath splits path into the field names that comprise it. It is the
+// inverse of JoinPath.
+func SplitPath(path string) []string {
+	var names []string
+	for path != "" {
+		var name string
+		if strings.HasPrefix(path, "[") {
+			if i := strings.Index(path, "]"); i >= 0 {
+				name, path = path[1:i], path[i+1:]
+				path = strings.TrimPrefix(path, ".")
+				names = append(names, name)
+				continue
+			}
+		}
+		name, path, _ = strings.Cut(path, ".")
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package textpb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWalk(t *testing.T) {
+	msg, err := ParseString(`a: 1 b { c: 2 d { e: 3 } } f { g: 4 } [x.y]: { z: 5 }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var got []string
+	v := VisitFuncs{
+		Message: func(path string, m Message) error {
+			got = append(got, "enter "+path)
+			return nil
+		},
+		Field: func(path string, f *Field) error {
+			if f.Name == "f" {
+				return SkipChildren
+			}
+			return nil
+		},
+		Value: func(path string, v *Value) error {
+			if v.Msg == nil {
+				got = append(got, path+"="+v.Text)
+				v.Text = "0" // replace the value in place
+			} else if path == "b.d" {
+				return SkipChildren
+			}
+			return nil
+		},
+		Leave: func(path string, m Message) error {
+			got = append(got, "leave "+path)
+			return nil
+		},
+	}
+	if err := Walk(msg, v); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	want := []string{
+		"enter ", "a=1", "enter b", "b.c=2", "leave b", "enter [x.y]", "[x.y].z=5", "leave [x.y]", "leave ",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Walk events (-want, +got):\n%s", diff)
+	}
+	if v, _ := pathValue(msg, "a"); v.Text != "0" {
+		t.Errorf("Value of a: got %q, want 0", v.Text)
+	}
+
+	errStop := errors.New("stop")
+	if err := Walk(msg, VisitFuncs{
+		Value: func(path string, v *Value) error {
+			if path == "b.d.e" {
+				return errStop
+			}
+			return nil
+		},
+	}); err != errStop {
+		t.Errorf("Walk: got error %v, want %v", err, errStop)
+	}
+}
+
+func TestAll(t *testing.T) {
+	msg, err := ParseString(`a: 1 a: 2 b { c { d: 3 } } [p/q.R] { s: 4 }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var got []string
+	for path, v := range msg.All() {
+		if v.Msg == nil {
+			got = append(got, path+"="+v.Text)
+		} else {
+			got = append(got, path)
+		}
+		if path == "[p/q.R]" {
+			break
+		}
+	}
+	want := []string{"a=1", "a=2", "b", "b.c", "b.c.d=3", "[p/q.R]"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("All (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	tests := []struct {
+		names []string
+		path  string
+	}{
+		{nil, ""},
+		{[]string{"a"}, "a"},
+		{[]string{"a", "b", "c"}, "a.b.c"},
+		{[]string{"a", "pkg.ext", "c"}, "a.[pkg.ext].c"},
+		{[]string{"type.googleapis.com/x.Y", "z"}, "[type.googleapis.com/x.Y].z"},
+	}
+	for _, test := range tests {
+		var path string
+		for _, name := range test.names {
+			path = JoinPath(path, name)
+		}
+		if path != test.path {
+			t.Errorf("JoinPath %q: got %q, want %q", strings.Join(test.names, ","), path, test.path)
+		}
+		if diff := cmp.Diff(test.names, SplitPath(path)); diff != "" {
+			t.Errorf("SplitPath %q (-want, +got):\n%s", path, diff)
+		}
+	}
+}
@@ -0,0 +1,694 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+var (
+	isName  = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+	isInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	isOct   = regexp.MustCompile(`^0o[0-7]+$`)
+	isHex   = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+	isFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+	isInf   = regexp.MustCompile(`^[-+]?\.(inf|Inf|INF)$`)
+	isNaN   = regexp.MustCompile(`^\.(nan|NaN|NAN)$`)
+)
+
+// Decode reads a YAML document from r and returns the message it describes.
+// The document must be a mapping, or empty. Each key of a mapping becomes a
+// field, and each element of a sequence becomes a separate value of the
+// field. A key enclosed in square brackets is read as an extension or type
+// name.
+//
+// Quoted scalars become strings. Plain scalars become Booleans, numbers, or
+// null values as given by the YAML core schema; otherwise they become
+// enumerators if they have the form of an identifier, or strings.
+//
+// The input must contain a single document; use DecodeAll to read a stream of
+// documents.
+func Decode(r io.Reader) (textpb.Message, error) {
+	d, err := readInput(r)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := d.document()
+	if err != nil {
+		return nil, err
+	} else if ln, more, err := d.more(); err != nil {
+		return nil, err
+	} else if more {
+		return nil, fail(ln.num, "multiple documents are not supported")
+	}
+	return msg, nil
+}
+
+// DecodeAll reads a stream of YAML documents from r, separated by "---" or
+// terminated by "...", and returns the messages they describe, in order. Each
+// document is decoded as by Decode.
+func DecodeAll(r io.Reader) ([]textpb.Message, error) {
+	d, err := readInput(r)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []textpb.Message
+	for {
+		msg, err := d.document()
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		if _, more, err := d.more(); err != nil {
+			return nil, err
+		} else if !more {
+			return msgs, nil
+		}
+	}
+}
+
+func readInput(r io.Reader) (*decoder, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(string(data)), nil
+}
+
+// A line is a single line of the input.
+type line struct {
+	num    int    // line number (1-based)
+	indent int    // number of leading spaces
+	text   string // content following indentation, without comments
+	raw    string // the complete text of the line
+	tab    bool   // the indentation is followed by a tab
+}
+
+type decoder struct {
+	lines []line
+	pos   int // offset of the current line
+}
+
+func newDecoder(input string) *decoder {
+	input = strings.TrimPrefix(input, "\ufeff")
+	var d decoder
+	for i, raw := range strings.Split(input, "\n") {
+		raw = strings.TrimSuffix(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		d.lines = append(d.lines, line{
+			num:    i + 1,
+			indent: len(raw) - len(text),
+			text:   strings.TrimRight(stripComment(text), " \t"),
+			raw:    raw,
+			tab:    strings.HasPrefix(text, "\t"),
+		})
+	}
+	return &d
+}
+
+func fail(num int, msg string, args ...any) error {
+	return fmt.Errorf(fmt.Sprintf("line %d: ", num)+msg, args...)
+}
+
+// peek skips blank lines and returns the current line, or reports false if
+// the input or the document is exhausted.
+func (d *decoder) peek() (line, bool, error) {
+	for d.pos < len(d.lines) {
+		ln := d.lines[d.pos]
+		if ln.text == "" {
+			d.pos++
+			continue
+		} else if ln.indent == 0 && (ln.text == "---" || ln.text == "...") {
+			return ln, false, nil
+		} else if ln.tab {
+			return ln, false, fail(ln.num, "tab character in indentation")
+		}
+		return ln, true, nil
+	}
+	return line{}, false, nil
+}
+
+// document parses a single document, beginning with an optional "---" and
+// ending at the next document marker or the end of the input. A terminating
+// "..." is consumed.
+func (d *decoder) document() (textpb.Message, error) {
+	ln, ok, err := d.peek()
+	if err != nil {
+		return nil, err
+	} else if !ok && ln.text == "---" {
+		d.pos++
+		ln, ok, err = d.peek()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var msg textpb.Message
+	if ok {
+		vals, seq, err := d.block(ln.indent)
+		if err != nil {
+			return nil, err
+		} else if seq || len(vals) != 1 || vals[0].Msg == nil {
+			return nil, fail(ln.num, "document must be a mapping")
+		}
+		msg = vals[0].Msg
+	}
+
+	ln, ok, err = d.peek()
+	if err != nil {
+		return nil, err
+	} else if ok {
+		return nil, fail(ln.num, "unexpected indentation")
+	} else if ln.text == "..." {
+		d.pos++
+	}
+	if len(msg) == 0 {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// more skips blank lines, and reports whether any input remains, along with
+// the current line.
+func (d *decoder) more() (line, bool, error) {
+	ln, _, err := d.peek()
+	return ln, d.pos < len(d.lines), err
+}
+
+// block parses a block node beginning at the current line, whose indentation
+// is indent. It reports true if the node is a sequence.
+func (d *decoder) block(indent int) ([]*textpb.Value, bool, error) {
+	ln := d.lines[d.pos]
+	if isSeqItem(ln.text) {
+		vals, err := d.sequence(indent)
+		return vals, true, err
+	} else if _, _, ok, err := splitKey(ln.text, ln.num); err != nil {
+		return nil, false, err
+	} else if ok {
+		msg, err := d.mapping(indent)
+		if err != nil {
+			return nil, false, err
+		}
+		return []*textpb.Value{{Msg: msg}}, false, nil
+	}
+	d.pos++
+	return d.value(ln.text, ln, true)
+}
+
+// mapping parses a block mapping whose keys have the given indentation.
+func (d *decoder) mapping(indent int) (textpb.Message, error) {
+	msg := textpb.Message{} // not nil, as that is the signal for a primitive
+	for {
+		ln, ok, err := d.peek()
+		if err != nil {
+			return nil, err
+		} else if !ok || ln.indent < indent {
+			return msg, nil
+		} else if ln.indent > indent {
+			return nil, fail(ln.num, "unexpected indentation")
+		}
+		key, rest, ok, err := splitKey(ln.text, ln.num)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fail(ln.num, "expected a mapping key")
+		}
+		d.pos++
+
+		var vals []*textpb.Value
+		if rest == "" {
+			vals, err = d.nested(indent, true)
+		} else {
+			vals, _, err = d.value(rest, ln, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, &textpb.Field{Name: key, Values: vals})
+	}
+}
+
+// sequence parses a block sequence whose items have the given indentation.
+func (d *decoder) sequence(indent int) ([]*textpb.Value, error) {
+	var vals []*textpb.Value
+	for {
+		ln, ok, err := d.peek()
+		if err != nil {
+			return nil, err
+		} else if !ok || ln.indent < indent || ln.indent == indent && !isSeqItem(ln.text) {
+			return vals, nil
+		} else if ln.indent > indent {
+			return nil, fail(ln.num, "unexpected indentation")
+		}
+		rest := strings.TrimLeft(ln.text[1:], " ")
+		offset := len(ln.text) - len(rest)
+
+		var item []*textpb.Value
+		var seq bool
+		if isSeqItem(rest) {
+			return nil, fail(ln.num, "nested sequences are not supported")
+		} else if _, _, ok, err := splitKey(rest, ln.num); err != nil {
+			return nil, err
+		} else if ok {
+			// A mapping that begins on the same line as the item indicator.
+			// Treat the remainder of the line as the first key of a mapping
+			// indented past the indicator.
+			d.lines[d.pos].indent += offset
+			d.lines[d.pos].text = rest
+			msg, err := d.mapping(indent + offset)
+			if err != nil {
+				return nil, err
+			}
+			item = []*textpb.Value{{Msg: msg}}
+		} else if rest == "" {
+			d.pos++
+			item, err = d.nested(indent, false)
+		} else {
+			d.pos++
+			item, seq, err = d.value(rest, ln, false)
+		}
+		if err != nil {
+			return nil, err
+		} else if seq {
+			return nil, fail(ln.num, "nested sequences are not supported")
+		}
+		vals = append(vals, item...)
+	}
+}
+
+// nested parses the value of a mapping key or sequence item that has no
+// content on its own line. The value is a block nested under the parent at
+// the given indentation, or null if there is none. If inMap is true, a
+// sequence at the same indentation as the parent is also accepted.
+func (d *decoder) nested(indent int, inMap bool) ([]*textpb.Value, error) {
+	ln, ok, err := d.peek()
+	if err != nil {
+		return nil, err
+	} else if ok && (ln.indent > indent || inMap && ln.indent == indent && isSeqItem(ln.text)) {
+		vals, seq, err := d.block(ln.indent)
+		if err == nil && !inMap && seq {
+			return nil, fail(ln.num, "nested sequences are not supported")
+		}
+		return vals, err
+	}
+	return []*textpb.Value{{Type: textpb.None, Text: "null"}}, nil
+}
+
+// value parses a value given by text, which occurs on line ln following a
+// mapping key or sequence indicator. If whole is true, text is the entire
+// content of the line. It reports true if the value is a sequence.
+func (d *decoder) value(text string, ln line, whole bool) ([]*textpb.Value, bool, error) {
+	switch text[0] {
+	case '|', '>':
+		if whole {
+			return nil, false, fail(ln.num, "unexpected block scalar")
+		}
+		s, err := d.blockScalar(text, ln)
+		if err != nil {
+			return nil, false, err
+		}
+		return []*textpb.Value{{Type: textpb.String, Text: s}}, false, nil
+	case '[', '{':
+		p := &flowParser{s: text, num: ln.num}
+		vals, seq, err := p.node()
+		if err != nil {
+			return nil, false, err
+		} else if p.space(); p.i < len(p.s) {
+			return nil, false, fail(ln.num, "unexpected %q after flow collection", p.s[p.i:])
+		}
+		return vals, seq, nil
+	case '&', '*', '!':
+		return nil, false, fail(ln.num, "anchors, aliases, and tags are not supported")
+	case '"', '\'':
+		s, n, err := unquote(text, ln.num)
+		if err != nil {
+			return nil, false, err
+		} else if n != len(text) {
+			return nil, false, fail(ln.num, "unexpected %q after quoted string", text[n:])
+		}
+		return []*textpb.Value{scalar(s, true)}, false, nil
+	}
+	return []*textpb.Value{scalar(text, false)}, false, nil
+}
+
+// blockScalar parses a literal (|) or folded (>) block scalar whose header
+// is given by text, on line ln, from the lines following ln.
+func (d *decoder) blockScalar(text string, ln line) (string, error) {
+	folded := text[0] == '>'
+	chomp, indent := byte(0), 0
+	for _, c := range []byte(text[1:]) {
+		switch {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+		case '1' <= c && c <= '9' && indent == 0:
+			indent = ln.indent + int(c-'0')
+		default:
+			return "", fail(ln.num, "invalid block scalar header %q", text)
+		}
+	}
+
+	var lines []string
+	for ; d.pos < len(d.lines); d.pos++ {
+		next := d.lines[d.pos]
+		if strings.TrimLeft(next.raw, " ") == "" {
+			lines = append(lines, "")
+			continue
+		} else if next.indent <= ln.indent {
+			break
+		} else if indent == 0 {
+			indent = next.indent
+		} else if next.indent < indent {
+			return "", fail(next.num, "insufficient indentation in block scalar")
+		}
+		lines = append(lines, next.raw[indent:])
+	}
+
+	// Separate trailing empty lines, which are governed by chomping.
+	n := len(lines)
+	for n > 0 && lines[n-1] == "" {
+		n--
+	}
+	trail := len(lines) - n
+	lines = lines[:n]
+
+	var sb strings.Builder
+	for i, s := range lines {
+		if i == 0 {
+			// no separator
+		} else if !folded || s == "" {
+			sb.WriteByte('\n')
+		} else if lines[i-1] != "" {
+			sb.WriteByte(' ') // a line break following an empty line is dropped
+		}
+		sb.WriteString(s)
+	}
+	switch {
+	case n == 0 || chomp == '-':
+	case chomp == '+':
+		sb.WriteString(strings.Repeat("\n", trail+1))
+	default:
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// A flowParser parses a flow collection on a single line.
+type flowParser struct {
+	s   string
+	i   int
+	num int // line number, for errors
+}
+
+func (p *flowParser) space() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *flowParser) peek() byte {
+	if p.space(); p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+// node parses a flow node. It reports true if the node is a sequence.
+func (p *flowParser) node() ([]*textpb.Value, bool, error) {
+	switch p.peek() {
+	case '[':
+		p.i++
+		var vals []*textpb.Value
+		for p.peek() != ']' {
+			v, seq, err := p.node()
+			if err != nil {
+				return nil, false, err
+			} else if seq {
+				return nil, false, fail(p.num, "nested sequences are not supported")
+			}
+			vals = append(vals, v...)
+			if !p.next(']') {
+				return nil, false, fail(p.num, "expected , or ] in flow sequence")
+			}
+		}
+		p.i++
+		return vals, true, nil
+
+	case '{':
+		p.i++
+		msg := textpb.Message{}
+		for p.peek() != '}' {
+			key, err := p.key()
+			if err != nil {
+				return nil, false, err
+			}
+			vals, _, err := p.node()
+			if err != nil {
+				return nil, false, err
+			}
+			msg = append(msg, &textpb.Field{Name: key, Values: vals})
+			if !p.next('}') {
+				return nil, false, fail(p.num, "expected , or } in flow mapping")
+			}
+		}
+		p.i++
+		return []*textpb.Value{{Msg: msg}}, false, nil
+
+	case '"', '\'':
+		s, n, err := unquote(p.s[p.i:], p.num)
+		if err != nil {
+			return nil, false, err
+		}
+		p.i += n
+		return []*textpb.Value{scalar(s, true)}, false, nil
+
+	case 0:
+		return nil, false, fail(p.num, "unterminated flow collection")
+	}
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune(",[]{}", rune(p.s[p.i])) {
+		p.i++
+	}
+	return []*textpb.Value{scalar(strings.TrimSpace(p.s[start:p.i]), false)}, false, nil
+}
+
+// next consumes a comma separating the elements of a collection, and
+// reports whether the separator or the given closing bracket follows.
+func (p *flowParser) next(end byte) bool {
+	switch p.peek() {
+	case ',':
+		p.i++
+		return true
+	case end:
+		return true
+	}
+	return false
+}
+
+// key parses a key and the following colon in a flow mapping.
+func (p *flowParser) key() (string, error) {
+	var key string
+	if c := p.peek(); c == '"' || c == '\'' {
+		s, n, err := unquote(p.s[p.i:], p.num)
+		if err != nil {
+			return "", err
+		}
+		key = typeName(s)
+		p.i += n
+	} else {
+		start := p.i
+		for p.i < len(p.s) && !strings.ContainsRune(":,[]{}", rune(p.s[p.i])) {
+			p.i++
+		}
+		key = strings.TrimSpace(p.s[start:p.i])
+	}
+	if p.peek() != ':' || key == "" {
+		return "", fail(p.num, "expected key: value in flow mapping")
+	}
+	p.i++
+	return key, nil
+}
+
+// splitKey splits text into a mapping key and the value following it. It
+// reports false if text does not begin with a key.
+func splitKey(text string, num int) (key, rest string, ok bool, err error) {
+	if text == "" {
+		return "", "", false, nil
+	} else if text[0] == '"' || text[0] == '\'' {
+		s, n, err := unquote(text, num)
+		if err != nil {
+			return "", "", false, err
+		}
+		rest := strings.TrimLeft(text[n:], " ")
+		if rest == ":" || strings.HasPrefix(rest, ": ") {
+			return typeName(s), strings.TrimLeft(rest[1:], " "), true, nil
+		}
+		return "", "", false, nil
+	} else if strings.ContainsRune("[]{}&*!|>%@`#", rune(text[0])) || isSeqItem(text) {
+		return "", "", false, nil
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return strings.TrimRight(text[:i], " "), strings.TrimLeft(text[i+2:], " "), true, nil
+	} else if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return strings.TrimRight(text[:len(text)-1], " "), "", true, nil
+	}
+	return "", "", false, nil
+}
+
+// typeName removes the square brackets from an extension or type name key.
+func typeName(key string) string {
+	if len(key) > 2 && key[0] == '[' && key[len(key)-1] == ']' {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+func isSeqItem(text string) bool { return text == "-" || strings.HasPrefix(text, "- ") }
+
+// scalar converts the text of a scalar to a value.
+func scalar(text string, quoted bool) *textpb.Value {
+	if quoted {
+		return &textpb.Value{Type: textpb.String, Text: text}
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return &textpb.Value{Type: textpb.None, Text: "null"}
+	case "true", "True", "TRUE":
+		return &textpb.Value{Type: textpb.True, Text: "true"}
+	case "false", "False", "FALSE":
+		return &textpb.Value{Type: textpb.False, Text: "false"}
+	}
+	if num, ok := numberText(text); ok {
+		return &textpb.Value{Type: textpb.Number, Text: num}
+	} else if isName.MatchString(text) {
+		return &textpb.Value{Type: textpb.Name, Text: text}
+	}
+	return &textpb.Value{Type: textpb.String, Text: text}
+}
+
+// numberText reports whether s is a number in the YAML core schema, and if
+// so returns the equivalent text-format numeric literal.
+func numberText(s string) (string, bool) {
+	switch {
+	case isInt.MatchString(s):
+		sign, digits := "", strings.TrimPrefix(s, "+")
+		if strings.HasPrefix(digits, "-") {
+			sign, digits = "-", digits[1:]
+		}
+		// YAML integers are decimal even with leading zeroes, which would
+		// make them octal in text format.
+		if t := strings.TrimLeft(digits, "0"); t != "" {
+			digits = t
+		} else {
+			digits = "0"
+		}
+		return sign + digits, true
+	case isOct.MatchString(s):
+		return "0" + s[2:], true
+	case isHex.MatchString(s):
+		return s, true
+	case isFloat.MatchString(s):
+		return strings.TrimPrefix(s, "+"), true
+	case isInf.MatchString(s):
+		return strings.ToLower(strings.TrimPrefix(strings.Replace(s, ".", "", 1), "+")), true
+	case isNaN.MatchString(s):
+		return "nan", true
+	}
+	return "", false
+}
+
+// unquote decodes the quoted scalar at the beginning of s, and returns its
+// contents and the number of bytes of s it occupies.
+func unquote(s string, num int) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				sb.WriteByte('\'')
+				i++
+				continue
+			}
+			return sb.String(), i + 1, nil
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && quote == '"':
+			n, err := unescape(&sb, s[i+1:])
+			if err != nil {
+				return "", 0, fail(num, "%v", err)
+			}
+			i += n
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fail(num, "unterminated quoted string")
+}
+
+var escapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n",
+	'v': "\v", 'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': `"`,
+	'/': "/", '\\': `\`, 'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unescape decodes the escape sequence at the beginning of s, which follows a
+// backslash, and reports the number of bytes consumed.
+func unescape(sb *strings.Builder, s string) (int, error) {
+	if s == "" {
+		return 0, errors.New("incomplete escape sequence")
+	} else if sub, ok := escapes[s[0]]; ok {
+		sb.WriteString(sub)
+		return 1, nil
+	}
+	var n int
+	switch s[0] {
+	case 'x':
+		n = 2
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		return 0, fmt.Errorf("invalid escape sequence %q", s[:1])
+	}
+	if len(s) < n+1 {
+		return 0, errors.New("incomplete escape sequence")
+	}
+	r, err := strconv.ParseUint(s[1:n+1], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(r)) {
+		return 0, fmt.Errorf("invalid escape sequence %q", s[:n+1])
+	}
+	sb.WriteRune(rune(r))
+	return n + 1, nil
+}
+
+// stripComment removes a comment from the end of text, if present. A comment
+// begins with "#" at the start of the text or following a space, outside
+// of a quoted scalar.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [{,:", text[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return text
+}
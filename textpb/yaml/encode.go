@@ -0,0 +1,175 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+// Package yaml converts textpb.Message values to and from YAML.
+//
+// The encoder writes block-style YAML documents that the decoder reads back
+// into the same message. The decoder handles the commonly-used subset of
+// YAML: block and flow mappings and sequences, plain and quoted scalars,
+// block scalars, and comments. Anchors, aliases, tags, and nested sequences
+// are not supported, the latter because there is no corresponding structure
+// in a message.
+package yaml
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+// isPlain matches names and keys that can be written without quotation.
+var isPlain = regexp.MustCompile(`^[_a-zA-Z0-9][-_a-zA-Z0-9]*$`)
+
+// Encode writes msg to w as a block-style YAML document. Each field becomes a
+// mapping key, and a field with more than one value becomes a sequence.
+// Fields are written in the order given; since YAML does not permit
+// duplicate keys, msg should be combined first if it may contain them.
+//
+// Strings are always quoted and enumerators are not, so that Decode can
+// distinguish them. The exception is an enumerator that YAML would read as a
+// null, Boolean, or number, such as True, which must be quoted and so decodes
+// as a string.
+//
+// The comments recorded for each field are written as YAML comments: Its
+// leading and trailing comment lines before and after it, its line comment
+// at the end of the line that holds its key, and the comments inside an
+// empty message value after that value.
+func Encode(w io.Writer, msg textpb.Message) error {
+	bw := bufio.NewWriter(w)
+	if len(msg) == 0 {
+		bw.WriteString("{}\n")
+	} else {
+		encodeFields(bw, msg, "", "")
+	}
+	return bw.Flush()
+}
+
+// encodeFields writes the fields of msg as a block mapping. The first line is
+// prefixed with lead, and subsequent lines with indent.
+func encodeFields(w *bufio.Writer, msg textpb.Message, lead, indent string) {
+	for i, f := range msg {
+		// Comments are not part of the indentation structure, so those
+		// preceding the first field go before its lead.
+		writeComments(w, f.Comments, indent)
+		if i == 0 {
+			w.WriteString(lead)
+		} else {
+			w.WriteString(indent)
+		}
+		w.WriteString(keyText(f.Name))
+		w.WriteByte(':')
+
+		switch len(f.Values) {
+		case 0:
+			w.WriteString(" []")
+			endLine(w, f.LineComment)
+		case 1:
+			encodeValue(w, f.Values[0], indent+"  ", f.LineComment)
+		default:
+			endLine(w, f.LineComment)
+			for _, v := range f.Values {
+				if len(v.Msg) != 0 {
+					// Begin the mapping on the same line as the indicator.
+					encodeFields(w, v.Msg, indent+"  - ", indent+"    ")
+				} else {
+					w.WriteString(indent + "  -")
+					encodeValue(w, v, indent+"    ", "")
+				}
+			}
+		}
+		writeComments(w, f.Inner, indent+"  ")
+		writeComments(w, f.Trailing, indent)
+	}
+}
+
+// encodeValue writes v following a mapping key or sequence indicator, using
+// indent for the lines of a nested mapping. If note is not empty, it is
+// written as a comment at the end of the first line.
+func encodeValue(w *bufio.Writer, v *textpb.Value, indent, note string) {
+	switch {
+	case v.Msg == nil:
+		w.WriteByte(' ')
+		w.WriteString(scalarText(v))
+		endLine(w, note)
+	case len(v.Msg) == 0:
+		w.WriteString(" {}")
+		endLine(w, note)
+	default:
+		endLine(w, note)
+		encodeFields(w, v.Msg, indent, indent)
+	}
+}
+
+// endLine ends the current line, with note as a comment if it is not empty.
+func endLine(w *bufio.Writer, note string) {
+	if note != "" {
+		w.WriteString(" #" + note)
+	}
+	w.WriteByte('\n')
+}
+
+// writeComments writes each of the given comment lines prefixed by indent.
+func writeComments(w *bufio.Writer, text []string, indent string) {
+	for _, line := range text {
+		w.WriteString(indent + "#" + line + "\n")
+	}
+}
+
+// keyText returns the YAML text of a mapping key for the given field name.
+func keyText(name string) string {
+	if isPlain.MatchString(name) && !isReserved(name) {
+		return name
+	} else if strings.ContainsAny(name, "./") {
+		name = "[" + name + "]" // extension or type URL
+	}
+	return strconv.Quote(name)
+}
+
+// scalarText returns the YAML text of the primitive value v.
+func scalarText(v *textpb.Value) string {
+	switch v.Type {
+	case textpb.None:
+		return "null"
+	case textpb.True:
+		return "true"
+	case textpb.False:
+		return "false"
+	case textpb.Name:
+		if isPlain.MatchString(v.Text) && !isReserved(v.Text) && !looksNumeric(v.Text) {
+			return v.Text
+		}
+	case textpb.TypeName:
+		return strconv.Quote("[" + v.Text + "]")
+	case textpb.Number:
+		if z, err := v.BigInt(); err == nil {
+			return z.String()
+		} else if fp, err := v.Number(); err == nil {
+			switch {
+			case math.IsNaN(fp):
+				return ".nan"
+			case math.IsInf(fp, 1):
+				return ".inf"
+			case math.IsInf(fp, -1):
+				return "-.inf"
+			}
+			return strconv.FormatFloat(fp, 'g', -1, 64)
+		}
+	}
+	return strconv.Quote(v.Text)
+}
+
+// isReserved reports whether s would be read as a null or Boolean constant.
+func isReserved(s string) bool {
+	switch s {
+	case "null", "Null", "NULL", "true", "True", "TRUE", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+// looksNumeric reports whether s would be read as a number.
+func looksNumeric(s string) bool { _, ok := numberText(s); return ok }
@@ -0,0 +1,223 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package yaml_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/creachadair/pson/textpb"
+	"github.com/creachadair/pson/textpb/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+func mustParse(t *testing.T, s string) textpb.Message {
+	t.Helper()
+	msg, err := textpb.ParseString(s)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", s, err)
+	}
+	return msg.Combine()
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", "{}\n"},
+		{`a: 1 b: "two" c: THREE d: true e: false`, "a: 1\nb: \"two\"\nc: THREE\nd: true\ne: false\n"},
+		{`a: 0x10 b: 2.50 c: -inf d: NULL e: 017`, "a: 16\nb: 2.5\nc: -.inf\nd: \"NULL\"\ne: 15\n"},
+		{`a {} b { c: 1 d { e: "x\ty" } }`, "a: {}\nb:\n  c: 1\n  d:\n    e: \"x\\ty\"\n"},
+		{`r: 1 r: 2`, "r:\n  - 1\n  - 2\n"},
+		{`r { x: 1 y: 2 } r {} r { z { w: 3 } }`,
+			"r:\n  - x: 1\n    y: 2\n  - {}\n  - z:\n      w: 3\n"},
+		{`[pkg.ext]: { v: 1 }`, "\"[pkg.ext]\":\n  v: 1\n"},
+		{`a { [x.y/z]: { b: [Q] } }`, "a:\n  \"[x.y/z]\":\n    b: Q\n"},
+	}
+	for _, test := range tests {
+		var buf strings.Builder
+		if err := yaml.Encode(&buf, mustParse(t, test.input)); err != nil {
+			t.Errorf("Encode %q: unexpected error: %v", test.input, err)
+		} else if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+			t.Errorf("Encode %q (-want, +got):\n%s", test.input, diff)
+		}
+	}
+
+	// A type name value, which the text parser does not produce, is written
+	// as a quoted string in brackets.
+	msg := textpb.Message{{Name: "b", Values: []*textpb.Value{{Type: textpb.TypeName, Text: "q.r"}}}}
+	var buf strings.Builder
+	if err := yaml.Encode(&buf, msg); err != nil {
+		t.Errorf("Encode %v: unexpected error: %v", msg, err)
+	} else if diff := cmp.Diff("b: \"[q.r]\"\n", buf.String()); diff != "" {
+		t.Errorf("Encode %v (-want, +got):\n%s", msg, diff)
+	}
+}
+
+func TestEncodeComments(t *testing.T) {
+	msg, err := textpb.ParseString(`# head
+a: 1 # line a
+b { # in b
+  c: 2
+  # end of b
+}
+d { # in d
+}
+r { x: 1 } # one
+r { y: 2 }
+# tail`)
+	if err != nil {
+		t.Fatalf("[BROKEN TEST] Parse failed: %v", err)
+	}
+	const want = `# head
+a: 1 # line a
+b:
+  # in b
+  c: 2
+  # end of b
+d: {}
+  # in d
+r: # one
+  - x: 1
+  - y: 2
+# tail
+`
+	var buf strings.Builder
+	if err := yaml.Encode(&buf, msg.Combine()); err != nil {
+		t.Fatalf("Encode: unexpected error: %v", err)
+	} else if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Encode (-want, +got):\n%s", diff)
+	}
+
+	// The comments are skipped when decoding.
+	got, err := yaml.Decode(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("Decode: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(mustParse(t, `a: 1 b { c: 2 } d {} r { x: 1 } r { y: 2 }`), got); diff != "" {
+		t.Errorf("Decode (-want, +got):\n%s", diff)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		`a: 1 b: "two" c: THREE d: true`,
+		`s: "multi\nline \"quoted\" \\ text" t: 'it''s' u: "null" v: "12"`,
+		`big: 18446744073709551616 neg: -5 f: 1e+100 n: nan`,
+		`r { x: 1 y { z: "s" } } r { x: 2 } q: A q: B`,
+		`[type.googleapis.com/foo.Bar] { v: 1 }`,
+	}
+	for _, input := range tests {
+		msg := mustParse(t, input)
+		var buf strings.Builder
+		if err := yaml.Encode(&buf, msg); err != nil {
+			t.Fatalf("Encode %q failed: %v", input, err)
+		}
+		got, err := yaml.Decode(strings.NewReader(buf.String()))
+		if err != nil {
+			t.Errorf("Decode %q failed: %v\n%s", input, err, buf.String())
+			continue
+		}
+		if diff := cmp.Diff(msg, got); diff != "" {
+			t.Errorf("Round trip %q (-want, +got):\n%s\nYAML:\n%s", input, diff, buf.String())
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", `{}`},
+		{"# just a comment\n---\n", `{}`},
+		{"a: 1\nb: hello world # comment\nc: 'x # y'\nd:\ne: ~\n", `{"a":1,"b":"hello world","c":"x # y","d":null,"e":null}`},
+		{"---\nname: web\nports:\n- 80\n- 443\nenv:\n  DEBUG: \"1\"\n  MODE: prod\n...\n",
+			`{"name":"web","ports":[80,443],"env":{"DEBUG":"1","MODE":"prod"}}`},
+		{"items:\n  - name: a\n    tags: [x, 'y z', 3]\n  - name: b\n    opts: {k: v, n: 0o17}\n  -\n",
+			`{"items":[{"name":"a","tags":["x","y z",3]},{"name":"b","opts":{"k":"v","n":15}},null]}`},
+		{"script: |\n  echo hi\n\n  exit 0\nfolded: >-\n  one\n  two\n\n  three\nkeep: |+\n  x\n\nlast: 1\n",
+			`{"script":"echo hi\n\nexit 0\n","folded":"one two\nthree","keep":"x\n\n","last":1}`},
+		{"a: 007\nb: +1.5\nc: -.INF\nd: .NaN\ne: 0x1F\nf: True\ng: \"\\u00e9\\x41\"\n",
+			`{"a":7,"b":1.5,"c":"-inf","d":"nan","e":31,"f":true,"g":"éA"}`},
+		{"{a: 1, b: [2, 3]}", `{"a":1,"b":[2,3]}`},
+		{"empty: []\nobj: {}\n", `{"empty":[],"obj":{}}`},
+	}
+	for _, test := range tests {
+		msg, err := yaml.Decode(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("Decode %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		got, err := msg.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON failed: %v", err)
+		}
+		if string(got) != test.want {
+			t.Errorf("Decode %q: got %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []string{
+		"- a\n- b\n",               // not a mapping
+		"just a scalar\n",          // not a mapping
+		"a: 1\n  b: 2\n",           // bad indentation
+		"a:\n  - - 1\n",            // nested sequence
+		"a: [[1]]\n",               // nested sequence
+		"a: &x 1\n",                // anchor
+		"a: *x\n",                  // alias
+		"a: 'open\n",               // unterminated string
+		"a: [1, 2\n",               // unterminated flow
+		"a: 1\n---\nb: 2\n",        // multiple documents
+		"a:\n\tb: 1\n",             // tab indentation
+		"a: \"\\q\"\n",             // bad escape
+		"a:\n  b: 1\n  - c\n",      // mixed mapping and sequence
+		"a: {b: 1} junk\n",         // trailing junk
+		"a: 1\nwhat is this\nc:\n", // not a key
+	}
+	for _, input := range tests {
+		msg, err := yaml.Decode(strings.NewReader(input))
+		if err == nil {
+			t.Errorf("Decode %q: got %+v, wanted error", input, msg)
+		} else {
+			t.Logf("Decode %q: got expected error: %v", input, err)
+		}
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", []string{`{}`}},
+		{"a: 1\n", []string{`{"a":1}`}},
+		{"a: 1\n---\nb: 2\n", []string{`{"a":1}`, `{"b":2}`}},
+		{"---\na: 1\n...\n---\nb: 2\n...\n", []string{`{"a":1}`, `{"b":2}`}},
+		{"a: 1\n...\nb: 2\n", []string{`{"a":1}`, `{"b":2}`}},
+		{"---\n---\nc: x\n", []string{`{}`, `{"c":"x"}`}},
+	}
+	for _, test := range tests {
+		msgs, err := yaml.DecodeAll(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("DecodeAll %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		var got []string
+		for _, msg := range msgs {
+			data, err := msg.MarshalJSON()
+			if err != nil {
+				t.Fatalf("MarshalJSON failed: %v", err)
+			}
+			got = append(got, string(data))
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("DecodeAll %q: wrong result (-want, +got):\n%s", test.input, diff)
+		}
+	}
+
+	if msgs, err := yaml.DecodeAll(strings.NewReader("a: 1\n---\n- b\n")); err == nil {
+		t.Errorf("DecodeAll: got %+v, wanted error", msgs)
+	}
+}
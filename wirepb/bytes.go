@@ -0,0 +1,160 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	errVarintOverflow = errors.New("varint overflows a 64-bit integer")
+	errGroupDepth     = fmt.Errorf("groups nested more than %d deep", maxGroupDepth)
+)
+
+// A BytesDecoder decodes a wire-format protobuf message held in memory. It is
+// like a Decoder, but does not copy the input: The Data of a fixed-width,
+// delimited, or group field is a subslice of the input, and the caller must
+// copy it if the input will be modified. The Data of a varint field are
+// converted to big-endian order, as for Decoder.
+type BytesDecoder struct {
+	data []byte
+	pos  int    // offset of the next field in data
+	base int    // offset of data in the original input
+	key  int    // offset in data of the last field returned
+	val  int    // offset in data of the contents of the last field returned
+	last *Field // the last field returned
+}
+
+// NewBytesDecoder creates a new decoder that reads fields from data.
+func NewBytesDecoder(data []byte) *BytesDecoder { return &BytesDecoder{data: data} }
+
+// Next returns the next field in the message, or io.EOF at the end of the
+// input. A group is returned as a single field of type TStartGroup whose data
+// are the encoded fields of the group.
+func (d *BytesDecoder) Next() (*Field, error) {
+	f, err := d.next(0)
+	if err != nil {
+		return nil, err
+	} else if f.Wire == TEndGroup {
+		return nil, fmt.Errorf("end of group %d without a beginning", f.ID)
+	}
+	d.last = f
+	return f, nil
+}
+
+// Offset returns the offset in the original input of the key of the field most
+// recently returned by Next. For a decoder created by Message, offsets are
+// relative to the input of the outermost decoder.
+func (d *BytesDecoder) Offset() int { return d.base + d.key }
+
+// Message returns a decoder for the contents of the field most recently
+// returned by Next, which must be a delimited field or a group. The contents
+// are not copied, and offsets reported by the new decoder are relative to the
+// original input.
+func (d *BytesDecoder) Message() (*BytesDecoder, error) {
+	if d.last == nil {
+		return nil, errors.New("no current field")
+	} else if d.last.Wire != TDelimited && d.last.Wire != TStartGroup {
+		return nil, fmt.Errorf("field %d is not delimited", d.last.ID)
+	}
+	return &BytesDecoder{data: d.last.Data, base: d.base + d.val}, nil
+}
+
+// next decodes the next field, including the end marker of an enclosing
+// group, and advances the position past it. The depth is the number of groups
+// enclosing the field.
+func (d *BytesDecoder) next(depth int) (*Field, error) {
+	if d.pos == len(d.data) {
+		return nil, io.EOF
+	}
+	d.key = d.pos
+	v, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	f := &Field{
+		ID:   int(v >> 3),
+		Wire: WireType(v & 7),
+	}
+	d.val = d.pos
+
+	var n int
+	switch f.Wire {
+	case TVarint:
+		w, err := d.uvarint()
+		if err != nil {
+			return nil, checkErr(err)
+		}
+		f.Data = PutUint64(w)
+		return f, nil
+
+	case TFixed64:
+		n = 8
+
+	case TDelimited:
+		w, err := d.uvarint()
+		if err != nil {
+			return nil, checkErr(err)
+		} else if w > uint64(len(d.data)-d.pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		d.val, n = d.pos, int(w)
+
+	case TStartGroup:
+		if depth >= maxGroupDepth {
+			return nil, errGroupDepth
+		}
+		return f, d.group(f, depth+1)
+
+	case TEndGroup:
+		return f, nil
+
+	case TFixed32:
+		n = 4
+
+	default:
+		return nil, fmt.Errorf("unknown wire type %d", f.Wire)
+	}
+	if n > len(d.data)-d.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+	f.Data = d.data[d.pos : d.pos+n : d.pos+n]
+	d.pos += n
+	return f, nil
+}
+
+// group skips the fields of group f up to its end marker, and sets f.Data to
+// the span of input they occupy. The depth is the number of groups enclosing
+// its fields.
+func (d *BytesDecoder) group(f *Field, depth int) error {
+	key, start := d.key, d.pos
+	for {
+		end := d.pos
+		g, err := d.next(depth)
+		if err != nil {
+			return checkErr(err)
+		} else if g.Wire == TEndGroup {
+			if g.ID != f.ID {
+				return fmt.Errorf("end of group %d inside group %d", g.ID, f.ID)
+			}
+			f.Data = d.data[start:end:end]
+			d.key, d.val = key, start
+			return nil
+		}
+	}
+}
+
+// uvarint decodes a varint at the current position and advances past it.
+func (d *BytesDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	} else if n < 0 {
+		return 0, errVarintOverflow
+	}
+	d.pos += n
+	return v, nil
+}
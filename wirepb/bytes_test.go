@@ -0,0 +1,135 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/creachadair/pson/wirepb"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBytesDecoder(t *testing.T) {
+	//             @1  #8  ....... @2  ........@3  .   .   .   .   .   @4  ....@5  @6  #0  @6
+	const input = "\012\010abcdefgh\021abcdefgh\030\xc4\x86\x89\x8a\x04\045****\053\062\000\054"
+	want := []struct {
+		offset int
+		key    int
+		wire   wirepb.WireType
+		data   string
+	}{
+		{0, 1, wirepb.TDelimited, "abcdefgh"},
+		{10, 2, wirepb.TFixed64, "abcdefgh"},
+		{19, 3, wirepb.TVarint, "ABCD"},
+		{25, 4, wirepb.TFixed32, "****"},
+		{30, 5, wirepb.TStartGroup, "\062\000"},
+	}
+	data := []byte(input)
+	dec := wirepb.NewBytesDecoder(data)
+	for i, test := range want {
+		got, err := dec.Next()
+		if err != nil {
+			t.Fatalf("dec.Next(): unexpected error: %v", err)
+		}
+		want := &wirepb.Field{test.key, test.wire, []byte(test.data)}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Record %d result differs from expected (-want, +got)\n%s", i, diff)
+		}
+		if off := dec.Offset(); off != test.offset {
+			t.Errorf("Record %d: got offset %d, want %d", i, off, test.offset)
+		}
+	}
+	if f, err := dec.Next(); err != io.EOF {
+		t.Errorf("dec.Next(): got %v, %v; want io.EOF", f, err)
+	}
+
+	// The data of a delimited field share the input.
+	dec = wirepb.NewBytesDecoder(data)
+	f, err := dec.Next()
+	if err != nil {
+		t.Fatalf("dec.Next(): unexpected error: %v", err)
+	}
+	data[2] = 'A'
+	if got := string(f.Data); got != "Abcdefgh" {
+		t.Errorf("Data after update: got %q, want %q", got, "Abcdefgh")
+	}
+	data[2] = 'a'
+}
+
+func TestBytesDecoderMessage(t *testing.T) {
+	//             @1  #4  @2  #2  @3  #0  @4  @5  #0  @4  @6  #1
+	const input = "\012\004\022\002\032\000\043\052\000\044\062\001x"
+	dec := wirepb.NewBytesDecoder([]byte(input))
+	if _, err := dec.Message(); err == nil {
+		t.Error("Message before Next: got nil, want error")
+	}
+
+	// Walk the nested fields, recording the offset of each.
+	type pos struct{ ID, Offset int }
+	var got []pos
+	var walk func(*wirepb.BytesDecoder)
+	walk = func(d *wirepb.BytesDecoder) {
+		for {
+			f, err := d.Next()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				t.Fatalf("Next: unexpected error: %v", err)
+			}
+			got = append(got, pos{f.ID, d.Offset()})
+			if f.ID == 6 {
+				continue // not a message
+			}
+			sub, err := d.Message()
+			if err != nil {
+				t.Fatalf("Message: unexpected error: %v", err)
+			}
+			walk(sub)
+		}
+	}
+	walk(dec)
+	want := []pos{{1, 0}, {2, 2}, {3, 4}, {4, 6}, {5, 7}, {6, 10}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Offsets (-want, +got):\n%s", diff)
+	}
+
+	// A scalar field has no nested message.
+	dec = wirepb.NewBytesDecoder([]byte("\010\001"))
+	if _, err := dec.Next(); err != nil {
+		t.Fatalf("Next: unexpected error: %v", err)
+	}
+	if _, err := dec.Message(); err == nil {
+		t.Error("Message of varint: got nil, want error")
+	}
+}
+
+func TestBytesDecoderErrors(t *testing.T) {
+	badInputs := []string{
+		"\010",     // missing varint
+		"\050\x83", // malformed varint
+		"\010\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01", // varint overflow
+		"\046",                     // unknown wire type
+		"\023",                     // unterminated group
+		"\034",                     // end of group without a beginning
+		"\023\034",                 // mismatched end of group
+		"\052\x0312",               // truncated delimited field
+		"\052\xff\xff\xff\xff\x0f", // delimited length past the end
+		"\061abcdef",               // truncated fixed64
+		"\075abc",                  // truncated fixed32
+	}
+nextTest:
+	for _, input := range badInputs {
+		dec := wirepb.NewBytesDecoder([]byte(input))
+		for {
+			_, err := dec.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Logf("Input %q: got expected error: %v", input, err)
+				continue nextTest
+			}
+		}
+		t.Errorf("Input %q: expected error, but succeeded", input)
+	}
+}
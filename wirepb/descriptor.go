@@ -0,0 +1,263 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"fmt"
+	"io"
+)
+
+// Field numbers from descriptor.proto, for the messages decoded by ReadSchema.
+const (
+	setFile = 1 // FileDescriptorSet.file
+
+	fileName       = 1  // FileDescriptorProto.name
+	filePackage    = 2  // FileDescriptorProto.package
+	fileDependency = 3  // FileDescriptorProto.dependency
+	fileMessage    = 4  // FileDescriptorProto.message_type
+	fileEnum       = 5  // FileDescriptorProto.enum_type
+	fileSyntax     = 12 // FileDescriptorProto.syntax
+
+	msgName    = 1 // DescriptorProto.name
+	msgField   = 2 // DescriptorProto.field
+	msgNested  = 3 // DescriptorProto.nested_type
+	msgEnum    = 4 // DescriptorProto.enum_type
+	msgOptions = 7 // DescriptorProto.options
+	msgOneof   = 8 // DescriptorProto.oneof_decl
+
+	msgOptMapEntry = 7 // MessageOptions.map_entry
+
+	fieldName     = 1  // FieldDescriptorProto.name
+	fieldNumber   = 3  // FieldDescriptorProto.number
+	fieldLabel    = 4  // FieldDescriptorProto.label
+	fieldType     = 5  // FieldDescriptorProto.type
+	fieldTypeName = 6  // FieldDescriptorProto.type_name
+	fieldDefault  = 7  // FieldDescriptorProto.default_value
+	fieldOptions  = 8  // FieldDescriptorProto.options
+	fieldOneof    = 9  // FieldDescriptorProto.oneof_index
+	fieldJSONName = 10 // FieldDescriptorProto.json_name
+
+	fieldOptPacked   = 2  // FieldOptions.packed
+	fieldOptFeatures = 21 // FieldOptions.features
+
+	featureRepeated = 3 // FeatureSet.repeated_field_encoding
+	featurePacked   = 1 // FeatureSet.RepeatedFieldEncoding.PACKED
+	featureExpanded = 2 // FeatureSet.RepeatedFieldEncoding.EXPANDED
+
+	oneofName = 1 // OneofDescriptorProto.name
+
+	enumName  = 1 // EnumDescriptorProto.name
+	enumValue = 2 // EnumDescriptorProto.value
+
+	enumValueName   = 1 // EnumValueDescriptorProto.name
+	enumValueNumber = 2 // EnumValueDescriptorProto.number
+)
+
+// ReadSchema reads a FileDescriptorSet message in wire format from r, as
+// written by protoc --descriptor_set_out, and returns a schema for the types
+// it defines. Parts of the descriptors not represented by FileDesc and its
+// constituents are ignored.
+func ReadSchema(r io.Reader) (*Schema, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var files []*FileDesc
+	if err := eachField(data, func(f *Field) error {
+		if f.ID != setFile {
+			return nil
+		}
+		file, err := decodeFileDesc(f)
+		if err == nil {
+			files = append(files, file)
+		}
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	return NewSchema(files...)
+}
+
+// eachField calls fn for each field of the message encoded by data.
+func eachField(data []byte, fn func(*Field) error) error {
+	dec := NewBytesDecoder(data)
+	for {
+		f, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// eachSub calls fn for each field of the message that is the value of f.
+func eachSub(f *Field, fn func(*Field) error) error {
+	data, err := f.AsBytes()
+	if err != nil {
+		return err
+	}
+	return eachField(data, fn)
+}
+
+func decodeFileDesc(f *Field) (*FileDesc, error) {
+	file := new(FileDesc)
+	err := eachSub(f, func(f *Field) (err error) {
+		switch f.ID {
+		case fileName:
+			file.Name, err = f.AsString()
+		case filePackage:
+			file.Package, err = f.AsString()
+		case fileDependency:
+			var dep string
+			dep, err = f.AsString()
+			file.Dependencies = append(file.Dependencies, dep)
+		case fileMessage:
+			var m *MessageDesc
+			m, err = decodeMessageDesc(f)
+			file.Messages = append(file.Messages, m)
+		case fileEnum:
+			var e *EnumDesc
+			e, err = decodeEnumDesc(f)
+			file.Enums = append(file.Enums, e)
+		case fileSyntax:
+			file.Syntax, err = f.AsString()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("file %q: %w", file.Name, err)
+	}
+	return file, nil
+}
+
+func decodeMessageDesc(f *Field) (*MessageDesc, error) {
+	m := new(MessageDesc)
+	err := eachSub(f, func(f *Field) (err error) {
+		switch f.ID {
+		case msgName:
+			m.Name, err = f.AsString()
+		case msgField:
+			var fd *FieldDesc
+			fd, err = decodeFieldDesc(f)
+			m.Fields = append(m.Fields, fd)
+		case msgNested:
+			var nm *MessageDesc
+			nm, err = decodeMessageDesc(f)
+			m.Nested = append(m.Nested, nm)
+		case msgEnum:
+			var e *EnumDesc
+			e, err = decodeEnumDesc(f)
+			m.Enums = append(m.Enums, e)
+		case msgOptions:
+			err = eachSub(f, func(f *Field) (err error) {
+				if f.ID == msgOptMapEntry {
+					m.MapEntry, err = f.AsBool()
+				}
+				return err
+			})
+		case msgOneof:
+			err = eachSub(f, func(f *Field) (err error) {
+				if f.ID == oneofName {
+					var name string
+					name, err = f.AsString()
+					m.Oneofs = append(m.Oneofs, name)
+				}
+				return err
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("message %q: %w", m.Name, err)
+	}
+	return m, nil
+}
+
+func decodeFieldDesc(f *Field) (*FieldDesc, error) {
+	fd := &FieldDesc{OneofIndex: -1}
+	err := eachSub(f, func(f *Field) (err error) {
+		var v int32
+		switch f.ID {
+		case fieldName:
+			fd.Name, err = f.AsString()
+		case fieldNumber:
+			v, err = f.AsInt32()
+			fd.Number = int(v)
+		case fieldLabel:
+			v, err = f.AsInt32()
+			fd.Label = Label(v)
+		case fieldType:
+			v, err = f.AsInt32()
+			fd.Type = Type(v)
+		case fieldTypeName:
+			fd.TypeName, err = f.AsString()
+		case fieldDefault:
+			fd.Default, err = f.AsString()
+		case fieldOptions:
+			err = eachSub(f, fd.decodeOption)
+		case fieldOneof:
+			v, err = f.AsInt32()
+			fd.OneofIndex = int(v)
+		case fieldJSONName:
+			fd.JSONName, err = f.AsString()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %w", fd.Name, err)
+	}
+	return fd, nil
+}
+
+// decodeOption decodes a field of FieldOptions into fd.
+func (fd *FieldDesc) decodeOption(f *Field) error {
+	switch f.ID {
+	case fieldOptPacked:
+		packed, err := f.AsBool()
+		fd.Packed = &packed
+		return err
+	case fieldOptFeatures:
+		return eachSub(f, func(f *Field) error {
+			if f.ID != featureRepeated {
+				return nil
+			}
+			enc, err := f.AsInt32()
+			if enc == featurePacked || enc == featureExpanded {
+				packed := enc == featurePacked
+				fd.Packed = &packed
+			}
+			return err
+		})
+	}
+	return nil
+}
+
+func decodeEnumDesc(f *Field) (*EnumDesc, error) {
+	e := new(EnumDesc)
+	err := eachSub(f, func(f *Field) (err error) {
+		switch f.ID {
+		case enumName:
+			e.Name, err = f.AsString()
+		case enumValue:
+			ev := new(EnumValueDesc)
+			err = eachSub(f, func(f *Field) (err error) {
+				switch f.ID {
+				case enumValueName:
+					ev.Name, err = f.AsString()
+				case enumValueNumber:
+					ev.Number, err = f.AsInt32()
+				}
+				return err
+			})
+			e.Values = append(e.Values, ev)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("enum %q: %w", e.Name, err)
+	}
+	return e, nil
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// An Encoder writes a wire-format protobuf message to an io.Writer, one field
+// at a time. Output is buffered; the caller must call Flush when done.
+//
+// A nested message is begun by BeginMessage and ended by EndMessage. Because
+// its length must precede its contents, the fields of a nested message are
+// held in memory until it is ended, and then written as a delimited field of
+// the enclosing message.
+type Encoder struct {
+	w     *bufio.Writer
+	stack []frame // nested messages under construction
+	buf   []byte  // scratch space for top-level fields
+}
+
+// A frame is a nested message under construction.
+type frame struct {
+	id  int
+	buf []byte
+}
+
+// NewEncoder creates a new encoder that writes data to w.
+func NewEncoder(w io.Writer) *Encoder { return &Encoder{w: bufio.NewWriter(w)} }
+
+// Field encodes f as the next field of the current message.
+func (e *Encoder) Field(f *Field) error {
+	if f.ID <= 0 || f.ID > maxFieldID {
+		return fmt.Errorf("invalid field number %d", f.ID)
+	}
+	if n := len(e.stack); n != 0 {
+		buf := f.Pack(e.stack[n-1].buf)
+		if buf == nil {
+			return fmt.Errorf("unknown wire type %d", f.Wire)
+		}
+		e.stack[n-1].buf = buf
+		return nil
+	}
+	e.buf = f.Pack(e.buf[:0])
+	if e.buf == nil {
+		return fmt.Errorf("unknown wire type %d", f.Wire)
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// Varint encodes a varint field with the given ID and value. This is the
+// encoding of the int32, int64, uint32, uint64, bool, and enum types; negative
+// int32 and int64 values are encoded as their 64-bit two's complement.
+func (e *Encoder) Varint(id int, v uint64) error {
+	return e.Field(&Field{ID: id, Wire: TVarint, Data: PutUint64(v)})
+}
+
+// Sint encodes a varint field with the given ID and the zig-zag encoding of z.
+// This is the encoding of the sint32 and sint64 types.
+func (e *Encoder) Sint(id int, z int64) error {
+	return e.Field(&Field{ID: id, Wire: TVarint, Data: PutInt64(z)})
+}
+
+// Fixed32 encodes a 32-bit fixed-width field with the given ID and value.
+// This is the encoding of the fixed32 and sfixed32 types.
+func (e *Encoder) Fixed32(id int, v uint32) error {
+	return e.Field(&Field{ID: id, Wire: TFixed32, Data: binary.LittleEndian.AppendUint32(nil, v)})
+}
+
+// Fixed64 encodes a 64-bit fixed-width field with the given ID and value.
+// This is the encoding of the fixed64 and sfixed64 types.
+func (e *Encoder) Fixed64(id int, v uint64) error {
+	return e.Field(&Field{ID: id, Wire: TFixed64, Data: binary.LittleEndian.AppendUint64(nil, v)})
+}
+
+// Float encodes a float field with the given ID and value.
+func (e *Encoder) Float(id int, v float32) error { return e.Fixed32(id, math.Float32bits(v)) }
+
+// Double encodes a double field with the given ID and value.
+func (e *Encoder) Double(id int, v float64) error { return e.Fixed64(id, math.Float64bits(v)) }
+
+// Bytes encodes a delimited field with the given ID and contents.
+func (e *Encoder) Bytes(id int, data []byte) error {
+	return e.Field(&Field{ID: id, Wire: TDelimited, Data: data})
+}
+
+// String encodes a delimited field with the given ID and contents.
+func (e *Encoder) String(id int, s string) error { return e.Bytes(id, []byte(s)) }
+
+// BeginMessage begins a nested message field with the given ID. Subsequent
+// fields belong to the nested message until the matching EndMessage.
+func (e *Encoder) BeginMessage(id int) error {
+	if id <= 0 || id > maxFieldID {
+		return fmt.Errorf("invalid field number %d", id)
+	}
+	e.stack = append(e.stack, frame{id: id})
+	return nil
+}
+
+// EndMessage ends the current nested message and encodes it as a field of
+// the enclosing message.
+func (e *Encoder) EndMessage() error {
+	n := len(e.stack) - 1
+	if n < 0 {
+		return errors.New("end of message without a beginning")
+	}
+	top := e.stack[n]
+	e.stack = e.stack[:n]
+	return e.Bytes(top.id, top.buf)
+}
+
+// Flush writes any buffered data to the underlying writer. It reports an
+// error if a nested message has not been ended.
+func (e *Encoder) Flush() error {
+	if len(e.stack) != 0 {
+		return fmt.Errorf("message %d was not ended", e.stack[len(e.stack)-1].id)
+	}
+	return e.w.Flush()
+}
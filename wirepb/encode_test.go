@@ -0,0 +1,75 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/creachadair/pson/wirepb"
+)
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := wirepb.NewEncoder(&buf)
+	steps := []func() error{
+		func() error { return enc.Varint(1, 150) },
+		func() error { return enc.String(2, "testing") },
+		func() error { return enc.BeginMessage(3) },
+		func() error { return enc.Sint(1, -1) },
+		func() error { return enc.BeginMessage(2) },
+		func() error { return enc.EndMessage() },
+		func() error { return enc.Fixed32(15, 1) },
+		func() error { return enc.EndMessage() },
+		func() error { return enc.Fixed64(4, 2) },
+		func() error { return enc.Float(5, 1) },
+		func() error { return enc.Double(6, -2) },
+		func() error { return enc.Bytes(7, nil) },
+		func() error { return enc.Varint(8, 1<<63) },
+		func() error { return enc.Flush() },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Step %d: unexpected error: %v", i+1, err)
+		}
+	}
+	const want = "\010\226\001" + // 1: 150
+		"\022\007testing" + // 2: "testing"
+		"\032\011\010\001\022\000\175\001\000\000\000" + // 3 { 1: -1 2 {} 15: 1 }
+		"\041\002\000\000\000\000\000\000\000" + // 4: 2
+		"\055\000\000\200\077" + // 5: 1.0f
+		"\061\000\000\000\000\000\000\000\300" + // 6: -2.0
+		"\072\000" + // 7: ""
+		"\100\200\200\200\200\200\200\200\200\200\001" // 8: 1<<63
+	if got := buf.String(); got != want {
+		t.Errorf("Encoder output:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		run  func(*wirepb.Encoder) error
+	}{
+		{"field number zero", func(e *wirepb.Encoder) error { return e.Varint(0, 1) }},
+		{"field number too large", func(e *wirepb.Encoder) error { return e.String(1<<29, "x") }},
+		{"invalid message number", func(e *wirepb.Encoder) error { return e.BeginMessage(-1) }},
+		{"unknown wire type", func(e *wirepb.Encoder) error {
+			return e.Field(&wirepb.Field{ID: 1, Wire: 7})
+		}},
+		{"unmatched end", func(e *wirepb.Encoder) error { return e.EndMessage() }},
+		{"unended message", func(e *wirepb.Encoder) error {
+			if err := e.BeginMessage(1); err != nil {
+				return err
+			}
+			return e.Flush()
+		}},
+	}
+	for _, test := range tests {
+		if err := test.run(wirepb.NewEncoder(new(bytes.Buffer))); err == nil {
+			t.Errorf("Encoder %s: got nil, want error", test.desc)
+		} else {
+			t.Logf("Encoder %s: got expected error: %v", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A packed repeated field of scalar type is encoded as a single delimited
+// field whose contents are the concatenated encodings of its values, without
+// field keys. The functions below decode and encode the contents of such a
+// field. The Pack functions append to buf, allowing the caller to control
+// allocation.
+
+// UnpackVarints decodes data as a sequence of varints. This is the encoding
+// of packed int32, int64, uint32, uint64, bool, and enum fields.
+func UnpackVarints(data []byte) ([]uint64, error) {
+	var out []uint64
+	for len(data) != 0 {
+		v, n := binary.Uvarint(data)
+		if n == 0 {
+			return nil, fmt.Errorf("truncated varint at element %d", len(out))
+		} else if n < 0 {
+			return nil, fmt.Errorf("varint overflow at element %d", len(out))
+		}
+		out = append(out, v)
+		data = data[n:]
+	}
+	return out, nil
+}
+
+// UnpackSints decodes data as a sequence of zig-zag encoded varints. This is
+// the encoding of packed sint32 and sint64 fields.
+func UnpackSints(data []byte) ([]int64, error) {
+	vs, err := UnpackVarints(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]int64, len(vs))
+	for i, v := range vs {
+		out[i] = int64(v>>1) ^ -int64(v&1)
+	}
+	return out, nil
+}
+
+// UnpackFixed32 decodes data as a sequence of 32-bit values. This is the
+// encoding of packed fixed32, sfixed32, and float fields.
+func UnpackFixed32(data []byte) ([]uint32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("packed fixed32 length %d is not a multiple of 4", len(data))
+	}
+	out := make([]uint32, len(data)/4)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	return out, nil
+}
+
+// UnpackFixed64 decodes data as a sequence of 64-bit values. This is the
+// encoding of packed fixed64, sfixed64, and double fields.
+func UnpackFixed64(data []byte) ([]uint64, error) {
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("packed fixed64 length %d is not a multiple of 8", len(data))
+	}
+	out := make([]uint64, len(data)/8)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	return out, nil
+}
+
+// PackVarints appends the packed encoding of vs to buf.
+func PackVarints(buf []byte, vs []uint64) []byte {
+	for _, v := range vs {
+		buf = binary.AppendUvarint(buf, v)
+	}
+	return buf
+}
+
+// PackSints appends the packed zig-zag encoding of zs to buf.
+func PackSints(buf []byte, zs []int64) []byte {
+	for _, z := range zs {
+		buf = binary.AppendUvarint(buf, uint64(z<<1)^uint64(z>>63))
+	}
+	return buf
+}
+
+// PackFixed32 appends the packed encoding of vs to buf.
+func PackFixed32(buf []byte, vs []uint32) []byte {
+	for _, v := range vs {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+	}
+	return buf
+}
+
+// PackFixed64 appends the packed encoding of vs to buf.
+func PackFixed64(buf []byte, vs []uint64) []byte {
+	for _, v := range vs {
+		buf = binary.LittleEndian.AppendUint64(buf, v)
+	}
+	return buf
+}
+
+// isPacked reports whether data plausibly holds packed varints: It must
+// consist entirely of varints in their shortest encoding, each of which fits
+// in 32 bits. Arbitrary binary data often decode as varints, but rarely meet
+// these constraints.
+func isPacked(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for len(data) != 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > 1<<32-1 || n != varintSize(v) {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
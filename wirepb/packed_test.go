@@ -0,0 +1,66 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/creachadair/pson/wirepb"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPacked(t *testing.T) {
+	t.Run("Varints", func(t *testing.T) {
+		vs := []uint64{0, 1, 150, math.MaxUint64}
+		const want = "\000\001\226\001\377\377\377\377\377\377\377\377\377\001"
+		checkPacked(t, vs, wirepb.PackVarints(nil, vs), want, wirepb.UnpackVarints)
+	})
+	t.Run("Sints", func(t *testing.T) {
+		zs := []int64{0, -1, 1, -2, math.MinInt64}
+		const want = "\000\001\002\003\377\377\377\377\377\377\377\377\377\001"
+		checkPacked(t, zs, wirepb.PackSints(nil, zs), want, wirepb.UnpackSints)
+	})
+	t.Run("Fixed32", func(t *testing.T) {
+		vs := []uint32{1, 0xdeadbeef}
+		const want = "\001\000\000\000\xef\xbe\xad\xde"
+		checkPacked(t, vs, wirepb.PackFixed32(nil, vs), want, wirepb.UnpackFixed32)
+	})
+	t.Run("Fixed64", func(t *testing.T) {
+		vs := []uint64{2, 0x0102030405060708}
+		const want = "\002\000\000\000\000\000\000\000\010\007\006\005\004\003\002\001"
+		checkPacked(t, vs, wirepb.PackFixed64(nil, vs), want, wirepb.UnpackFixed64)
+	})
+}
+
+func checkPacked[T any](t *testing.T, vs []T, packed []byte, want string, unpack func([]byte) ([]T, error)) {
+	t.Helper()
+	if got := string(packed); got != want {
+		t.Errorf("Pack %v: got %q, want %q", vs, got, want)
+	}
+	got, err := unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack %q: unexpected error: %v", packed, err)
+	}
+	if diff := cmp.Diff(vs, got); diff != "" {
+		t.Errorf("Unpack %q (-want, +got):\n%s", packed, diff)
+	}
+}
+
+func TestPackedErrors(t *testing.T) {
+	if got, err := wirepb.UnpackVarints([]byte("\001\200")); err == nil {
+		t.Errorf("UnpackVarints truncated: got %v, want error", got)
+	}
+	if got, err := wirepb.UnpackVarints([]byte("\377\377\377\377\377\377\377\377\377\377\001")); err == nil {
+		t.Errorf("UnpackVarints overflow: got %v, want error", got)
+	}
+	if got, err := wirepb.UnpackSints([]byte("\200")); err == nil {
+		t.Errorf("UnpackSints truncated: got %v, want error", got)
+	}
+	if got, err := wirepb.UnpackFixed32([]byte("12345")); err == nil {
+		t.Errorf("UnpackFixed32 bad length: got %v, want error", got)
+	}
+	if got, err := wirepb.UnpackFixed64([]byte("1234")); err == nil {
+		t.Errorf("UnpackFixed64 bad length: got %v, want error", got)
+	}
+}
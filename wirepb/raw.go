@@ -0,0 +1,129 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+// maxFieldID is the largest field number permitted by the protobuf encoding.
+const maxFieldID = 1<<29 - 1
+
+// DecodeRaw reads a complete wire-format message from r and returns it as a
+// textpb.Message, in the manner of protoc --decode_raw. Since the schema is
+// not known, each field is named by its decimal field number, and its value
+// is rendered according to its wire type:
+//
+// Varint values are written as unsigned decimal numbers. Fixed-width values
+// are written as hexadecimal numbers, 0x%08x for 32-bit and 0x%016x for 64-bit
+// values. A group is decoded as a nested message. A delimited value that looks
+// like text is written as a string. Otherwise it is decoded as a nested
+// message if its contents parse as one, or as a packed repeated field if its
+// contents are a plausible run of varints, and failing that it is written as a
+// string of bytes. Past 100 levels of nested messages, every group or
+// delimited value is written as bytes.
+func DecodeRaw(r io.Reader) (textpb.Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := rawMessage(data, 0)
+	if err != nil {
+		return nil, err
+	} else if len(msg) == 0 {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// rawMessage decodes data as a sequence of fields. It reports an error if
+// data is not entirely consumed by well-formed fields. The depth is the
+// number of messages enclosing data.
+func rawMessage(data []byte, depth int) (textpb.Message, error) {
+	msg := textpb.Message{}
+	dec := NewBytesDecoder(data)
+	for {
+		f, err := dec.Next()
+		if err == io.EOF {
+			return msg, nil
+		} else if err != nil {
+			return nil, err
+		} else if f.ID <= 0 || f.ID > maxFieldID {
+			return nil, fmt.Errorf("invalid field number %d", f.ID)
+		}
+		msg = append(msg, &textpb.Field{
+			Name:   strconv.Itoa(f.ID),
+			Values: rawValues(f, depth),
+		})
+	}
+}
+
+// rawValues returns the values of f, guessing their type from the wire type
+// and the contents of the field. There is more than one value only for a
+// packed field. Past maxGroupDepth enclosing messages, the contents of a group
+// or delimited field are no longer guessed at, but written as bytes.
+func rawValues(f *Field, depth int) []*textpb.Value {
+	nest := depth < maxGroupDepth
+	switch f.Wire {
+	case TVarint:
+		return []*textpb.Value{varintValue(Uint64(f.Data))}
+	case TFixed32:
+		return []*textpb.Value{{Type: textpb.Number, Text: fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(f.Data))}}
+	case TFixed64:
+		return []*textpb.Value{{Type: textpb.Number, Text: fmt.Sprintf("0x%016x", binary.LittleEndian.Uint64(f.Data))}}
+	case TStartGroup:
+		if !nest {
+			break
+		} else if msg, err := rawMessage(f.Data, depth+1); err == nil {
+			return []*textpb.Value{{Msg: msg}}
+		}
+	}
+
+	// An empty value could be anything; the empty string is the least
+	// surprising choice.
+	if nest && len(f.Data) != 0 && !isText(f.Data) {
+		if msg, err := rawMessage(f.Data, depth+1); err == nil {
+			return []*textpb.Value{{Msg: msg}}
+		} else if isPacked(f.Data) {
+			vs, _ := UnpackVarints(f.Data)
+			out := make([]*textpb.Value, len(vs))
+			for i, v := range vs {
+				out[i] = varintValue(v)
+			}
+			return out
+		}
+	}
+	return []*textpb.Value{{Type: textpb.String, Text: string(f.Data)}}
+}
+
+func varintValue(v uint64) *textpb.Value {
+	return &textpb.Value{Type: textpb.Number, Text: strconv.FormatUint(v, 10)}
+}
+
+// isText reports whether data is valid UTF-8 consisting of printable
+// characters, tabs, and line breaks, not beginning with a control character.
+// Many short strings are also well-formed messages, but the encoding of a
+// message begins with a field key, which for small field numbers is a
+// control character.
+func isText(data []byte) bool {
+	if len(data) == 0 || data[0] < ' ' {
+		return false
+	}
+	for len(data) != 0 {
+		r, n := utf8.DecodeRune(data)
+		if r == utf8.RuneError && n == 1 {
+			return false
+		} else if !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/pson/textpb/format"
+	"github.com/creachadair/pson/wirepb"
+)
+
+func TestDecodeRaw(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"\010\226\001", `1:150`},
+		{"\022\007testing", `2:"testing"`},
+		{"\032\004\010\001\020\002", `3 {1:1 2:2}`},
+		{"\045\001\000\000\000", `4:0x00000001`},
+		{"\051\002\000\000\000\000\000\000\000", `5:0x0000000000000002`},
+		{"\062\002\377\000", `6:"\377\000"`},
+		{"\072\000", `7:""`},
+		{"\010\001\010\002", `1:1 1:2`},
+
+		// Text that is also a well-formed message is kept as text.
+		{"\012\002(a", `1:"(a"`},
+		{"\012\013hello\nworld", `1:"hello\nworld"`},
+
+		// Nested messages are decoded recursively.
+		{"\012\006\022\004\030\001\030\002", `1 {2 {3:1 3:2}}`},
+
+		// Groups are decoded as nested messages.
+		{"\013\020\001\033\034\014", `1 {2:1 3 {}}`},
+
+		// Malformed contents are kept as bytes.
+		{"\012\002\010\200", `1:"\010\200"`},
+		{"\012\002\377\000", `1:"\377\000"`},
+		{"\012\005\200\200\200\200\020", `1:"\200\200\200\200\020"`},
+
+		// Plausible runs of varints are decoded as packed fields.
+		{"\012\001\000", `1:0`},
+		{"\012\004\001\002\226\001", `1:1 1:2 1:150`},
+	}
+	cfg := format.Config{Compact: true, Curly: true}
+	for _, test := range tests {
+		msg, err := wirepb.DecodeRaw(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("DecodeRaw %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := cfg.Text(&buf, msg); err != nil {
+			t.Errorf("Text %q: unexpected error: %v", test.input, err)
+		} else if got := buf.String(); got != test.want {
+			t.Errorf("DecodeRaw %q: got %#q, want %#q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestDecodeRawErrors(t *testing.T) {
+	badInputs := []string{
+		"\010",                     // missing varint
+		"\002\001x",                // field number zero
+		"\052\003ab",               // truncated delimited field
+		"\013\024",                 // mismatched end of group
+		"\200\200\200\200\020\001", // field number out of range
+	}
+	for _, input := range badInputs {
+		got, err := wirepb.DecodeRaw(strings.NewReader(input))
+		if err == nil {
+			t.Errorf("DecodeRaw %q: got %v, want error", input, got)
+		}
+	}
+}
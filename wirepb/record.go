@@ -0,0 +1,145 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A Framing describes how the records of a stream are delimited.
+type Framing int
+
+// Constants defining the supported record framings.
+const (
+	// Each record is preceded by its length as a varint. This is the format
+	// written by writeDelimitedTo in the Java and C++ protobuf libraries.
+	FrameVarint Framing = iota
+
+	// Each record is preceded by its length as a 4-byte big-endian integer.
+	FrameFixed32
+)
+
+func (f Framing) String() string {
+	switch f {
+	case FrameVarint:
+		return "varint"
+	case FrameFixed32:
+		return "fixed32"
+	default:
+		return fmt.Sprintf("Framing(%d)", int(f))
+	}
+}
+
+// DefaultMaxRecord is the default limit on the size of a record, used by a
+// RecordReader or RecordWriter whose MaxSize is zero.
+const DefaultMaxRecord = 64 << 20
+
+// A RecordReader reads length-prefixed records from an io.Reader.
+type RecordReader struct {
+	buf     *bufio.Reader
+	framing Framing
+
+	// MaxSize is the largest record size in bytes that will be accepted. If
+	// zero, DefaultMaxRecord is used. A longer record is reported as an error
+	// without reading its contents.
+	MaxSize int
+}
+
+// NewRecordReader creates a new reader for records with the given framing
+// from r.
+func NewRecordReader(r io.Reader, framing Framing) *RecordReader {
+	return &RecordReader{buf: bufio.NewReader(r), framing: framing}
+}
+
+// Next returns the contents of the next record, or io.EOF if there are no
+// further records. A stream that ends within a record reports
+// io.ErrUnexpectedEOF.
+func (r *RecordReader) Next() ([]byte, error) {
+	var size uint64
+	switch r.framing {
+	case FrameVarint:
+		v, err := binary.ReadUvarint(r.buf)
+		if err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("reading record length: %w", err)
+		}
+		size = v
+
+	case FrameFixed32:
+		var hdr [4]byte
+		if _, err := io.ReadFull(r.buf, hdr[:]); err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("reading record length: %w", err)
+		}
+		size = uint64(binary.BigEndian.Uint32(hdr[:]))
+
+	default:
+		return nil, fmt.Errorf("unknown framing %v", r.framing)
+	}
+	if max := maxSize(r.MaxSize); size > uint64(max) {
+		return nil, fmt.Errorf("record size %d exceeds limit %d", size, max)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.buf, data); err != nil {
+		return nil, checkErr(err)
+	}
+	return data, nil
+}
+
+// A RecordWriter writes length-prefixed records to an io.Writer. Output is
+// buffered; the caller must call Flush when done.
+type RecordWriter struct {
+	w       *bufio.Writer
+	framing Framing
+
+	// MaxSize is the largest record size in bytes that will be written. If
+	// zero, DefaultMaxRecord is used.
+	MaxSize int
+}
+
+// NewRecordWriter creates a new writer for records with the given framing to
+// w.
+func NewRecordWriter(w io.Writer, framing Framing) *RecordWriter {
+	return &RecordWriter{w: bufio.NewWriter(w), framing: framing}
+}
+
+// WriteRecord writes data as a single record.
+func (w *RecordWriter) WriteRecord(data []byte) error {
+	if max := maxSize(w.MaxSize); len(data) > max {
+		return fmt.Errorf("record size %d exceeds limit %d", len(data), max)
+	}
+	var hdr []byte
+	switch w.framing {
+	case FrameVarint:
+		hdr = binary.AppendUvarint(nil, uint64(len(data)))
+	case FrameFixed32:
+		if uint64(len(data)) > math.MaxUint32 {
+			return errors.New("record too long for fixed32 framing")
+		}
+		hdr = binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	default:
+		return fmt.Errorf("unknown framing %v", w.framing)
+	}
+	if _, err := w.w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.w.Write(data)
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *RecordWriter) Flush() error { return w.w.Flush() }
+
+func maxSize(n int) int {
+	if n <= 0 {
+		return DefaultMaxRecord
+	}
+	return n
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/pson/wirepb"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecords(t *testing.T) {
+	records := []string{"", "abc", strings.Repeat("x", 300)}
+	tests := []struct {
+		framing wirepb.Framing
+		prefix  []string
+	}{
+		{wirepb.FrameVarint, []string{"\000", "\003", "\254\002"}},
+		{wirepb.FrameFixed32, []string{"\000\000\000\000", "\000\000\000\003", "\000\000\001\054"}},
+	}
+	for _, test := range tests {
+		t.Run(test.framing.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := wirepb.NewRecordWriter(&buf, test.framing)
+			var want string
+			for i, rec := range records {
+				if err := w.WriteRecord([]byte(rec)); err != nil {
+					t.Fatalf("WriteRecord %d: unexpected error: %v", i, err)
+				}
+				want += test.prefix[i] + rec
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush: unexpected error: %v", err)
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("Output: got %q, want %q", got, want)
+			}
+
+			var got []string
+			r := wirepb.NewRecordReader(&buf, test.framing)
+			for {
+				rec, err := r.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Next: unexpected error: %v", err)
+				}
+				got = append(got, string(rec))
+			}
+			if diff := cmp.Diff(records, got); diff != "" {
+				t.Errorf("Records (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRecordLimits(t *testing.T) {
+	w := wirepb.NewRecordWriter(io.Discard, wirepb.FrameVarint)
+	w.MaxSize = 3
+	if err := w.WriteRecord([]byte("abc")); err != nil {
+		t.Errorf("WriteRecord at limit: unexpected error: %v", err)
+	}
+	if err := w.WriteRecord([]byte("abcd")); err == nil {
+		t.Error("WriteRecord over limit: got nil, want error")
+	}
+
+	r := wirepb.NewRecordReader(strings.NewReader("\003abc\004abcd"), wirepb.FrameVarint)
+	r.MaxSize = 3
+	if rec, err := r.Next(); err != nil || string(rec) != "abc" {
+		t.Errorf("Next at limit: got %q, %v; want %q, nil", rec, err, "abc")
+	}
+	if rec, err := r.Next(); err == nil {
+		t.Errorf("Next over limit: got %q, want error", rec)
+	}
+
+	// The default limit applies without reading the record.
+	r = wirepb.NewRecordReader(strings.NewReader("\377\377\377\377"), wirepb.FrameFixed32)
+	if rec, err := r.Next(); err == nil {
+		t.Errorf("Next over default limit: got %d bytes, want error", len(rec))
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+	tests := []struct {
+		framing wirepb.Framing
+		input   string
+	}{
+		{wirepb.FrameVarint, "\200"},               // truncated length
+		{wirepb.FrameVarint, "\005abc"},            // truncated record
+		{wirepb.FrameFixed32, "\000\000"},          // truncated length
+		{wirepb.FrameFixed32, "\000\000\000\002a"}, // truncated record
+		{wirepb.Framing(9), "\000"},                // unknown framing
+	}
+	for _, test := range tests {
+		r := wirepb.NewRecordReader(strings.NewReader(test.input), test.framing)
+		if rec, err := r.Next(); err == nil || err == io.EOF {
+			t.Errorf("Next %v %q: got %q, %v; want error", test.framing, test.input, rec, err)
+		} else {
+			t.Logf("Next %v %q: got expected error: %v", test.framing, test.input, err)
+		}
+	}
+	if err := wirepb.NewRecordWriter(io.Discard, wirepb.Framing(9)).WriteRecord(nil); err == nil {
+		t.Error("WriteRecord with unknown framing: got nil, want error")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Type identifies the declared type of a message field. The values are
+// those of FieldDescriptorProto.Type in descriptor.proto.
+type Type int
+
+// Constants defining the field types.
+const (
+	TypeDouble   Type = 1
+	TypeFloat    Type = 2
+	TypeInt64    Type = 3
+	TypeUint64   Type = 4
+	TypeInt32    Type = 5
+	TypeFixed64  Type = 6
+	TypeFixed32  Type = 7
+	TypeBool     Type = 8
+	TypeString   Type = 9
+	TypeGroup    Type = 10
+	TypeMessage  Type = 11
+	TypeBytes    Type = 12
+	TypeUint32   Type = 13
+	TypeEnum     Type = 14
+	TypeSfixed32 Type = 15
+	TypeSfixed64 Type = 16
+	TypeSint32   Type = 17
+	TypeSint64   Type = 18
+)
+
+var typeName = [...]string{
+	TypeDouble: "double", TypeFloat: "float", TypeInt64: "int64", TypeUint64: "uint64",
+	TypeInt32: "int32", TypeFixed64: "fixed64", TypeFixed32: "fixed32", TypeBool: "bool",
+	TypeString: "string", TypeGroup: "group", TypeMessage: "message", TypeBytes: "bytes",
+	TypeUint32: "uint32", TypeEnum: "enum", TypeSfixed32: "sfixed32", TypeSfixed64: "sfixed64",
+	TypeSint32: "sint32", TypeSint64: "sint64",
+}
+
+func (t Type) String() string {
+	if t > 0 && int(t) < len(typeName) {
+		return typeName[t]
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Wire returns the wire type used to encode a single value of type t.
+func (t Type) Wire() WireType {
+	switch t {
+	case TypeDouble, TypeFixed64, TypeSfixed64:
+		return TFixed64
+	case TypeFloat, TypeFixed32, TypeSfixed32:
+		return TFixed32
+	case TypeString, TypeBytes, TypeMessage:
+		return TDelimited
+	case TypeGroup:
+		return TStartGroup
+	}
+	return TVarint
+}
+
+// IsScalar reports whether values of type t are numeric, and may therefore be
+// packed in a repeated field.
+func (t Type) IsScalar() bool {
+	switch t {
+	case TypeString, TypeBytes, TypeMessage, TypeGroup:
+		return false
+	}
+	return t > 0 && int(t) < len(typeName)
+}
+
+// A Label identifies the cardinality of a message field. The values are those
+// of FieldDescriptorProto.Label in descriptor.proto.
+type Label int
+
+// Constants defining the field labels.
+const (
+	LabelOptional Label = 1
+	LabelRequired Label = 2
+	LabelRepeated Label = 3
+)
+
+// A FileDesc describes the contents of a .proto file, after the fashion of
+// FileDescriptorProto. Only the parts needed to encode and decode messages
+// are represented.
+type FileDesc struct {
+	Name         string
+	Package      string
+	Syntax       string // "proto2" (or empty), "proto3", or "editions"
+	Dependencies []string
+	Messages     []*MessageDesc
+	Enums        []*EnumDesc
+}
+
+// A MessageDesc describes a message type, after the fashion of
+// DescriptorProto.
+type MessageDesc struct {
+	Name     string // the simple name of the type
+	FullName string // the fully-qualified name, set by NewSchema
+	Fields   []*FieldDesc
+	Nested   []*MessageDesc
+	Enums    []*EnumDesc
+	Oneofs   []string // the names of the oneofs declared by the message
+	MapEntry bool     // whether this is the entry type of a map field
+
+	byNumber map[int]*FieldDesc
+	byName   map[string]*FieldDesc
+}
+
+// FieldByNumber returns the field of m with the given number, or nil.
+func (m *MessageDesc) FieldByNumber(n int) *FieldDesc { return m.byNumber[n] }
+
+// FieldByName returns the field of m with the given name, or nil. A group
+// field may also be found by the name of its type.
+func (m *MessageDesc) FieldByName(name string) *FieldDesc { return m.byName[name] }
+
+// A FieldDesc describes a field of a message type, after the fashion of
+// FieldDescriptorProto.
+type FieldDesc struct {
+	Name   string
+	Number int
+	Label  Label
+	Type   Type // may be zero for a message or enum type, to be resolved
+
+	// For a message, group, or enum field, TypeName is the name of the type
+	// as written. A name with a leading "." is fully-qualified; otherwise it
+	// is resolved relative to the scope of the enclosing message.
+	TypeName string
+
+	JSONName   string
+	Default    string
+	OneofIndex int   // the index of the enclosing oneof, or -1 if none
+	Packed     *bool // the packed option, if set
+
+	Message *MessageDesc // the type of a message or group field, set by NewSchema
+	Enum    *EnumDesc    // the type of an enum field, set by NewSchema
+
+	packed bool // whether a repeated field is encoded packed
+}
+
+// IsRepeated reports whether f is a repeated field.
+func (f *FieldDesc) IsRepeated() bool { return f.Label == LabelRepeated }
+
+// IsPacked reports whether the values of f are encoded in packed form.
+func (f *FieldDesc) IsPacked() bool { return f.packed }
+
+// An EnumDesc describes an enumeration type, after the fashion of
+// EnumDescriptorProto.
+type EnumDesc struct {
+	Name     string // the simple name of the type
+	FullName string // the fully-qualified name, set by NewSchema
+	Values   []*EnumValueDesc
+}
+
+// ValueByNumber returns the first value of e with the given number, or nil.
+func (e *EnumDesc) ValueByNumber(n int32) *EnumValueDesc {
+	for _, v := range e.Values {
+		if v.Number == n {
+			return v
+		}
+	}
+	return nil
+}
+
+// ValueByName returns the value of e with the given name, or nil.
+func (e *EnumDesc) ValueByName(name string) *EnumValueDesc {
+	for _, v := range e.Values {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// An EnumValueDesc describes a named value of an enumeration type.
+type EnumValueDesc struct {
+	Name   string
+	Number int32
+}
+
+// A Schema is a collection of message and enum types, indexed by their
+// fully-qualified names.
+type Schema struct {
+	Files []*FileDesc
+
+	messages map[string]*MessageDesc
+	enums    map[string]*EnumDesc
+}
+
+// NewSchema constructs a schema from the types declared in files. It sets the
+// full names of the types, and resolves the type names of fields. It reports
+// an error if a type is defined more than once, or a type name does not
+// refer to a known type.
+func NewSchema(files ...*FileDesc) (*Schema, error) {
+	s := &Schema{
+		Files:    files,
+		messages: make(map[string]*MessageDesc),
+		enums:    make(map[string]*EnumDesc),
+	}
+	for _, file := range files {
+		if err := s.addTypes(file.Package, file.Messages, file.Enums); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+	for _, file := range files {
+		packed := file.Syntax != "" && file.Syntax != "proto2"
+		for _, m := range file.Messages {
+			if err := s.resolve(m, packed); err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Name, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Message returns the message type with the given fully-qualified name, with
+// or without a leading ".", or nil if there is none.
+func (s *Schema) Message(name string) *MessageDesc { return s.messages[strings.TrimPrefix(name, ".")] }
+
+// Enum returns the enum type with the given fully-qualified name, with or
+// without a leading ".", or nil if there is none.
+func (s *Schema) Enum(name string) *EnumDesc { return s.enums[strings.TrimPrefix(name, ".")] }
+
+// addTypes records the full names of msgs and enums in the given scope, and
+// of their nested types.
+func (s *Schema) addTypes(scope string, msgs []*MessageDesc, enums []*EnumDesc) error {
+	for _, e := range enums {
+		e.FullName = qualify(scope, e.Name)
+		if err := s.define(e.FullName); err != nil {
+			return err
+		}
+		s.enums[e.FullName] = e
+	}
+	for _, m := range msgs {
+		m.FullName = qualify(scope, m.Name)
+		if err := s.define(m.FullName); err != nil {
+			return err
+		}
+		s.messages[m.FullName] = m
+		if err := s.addTypes(m.FullName, m.Nested, m.Enums); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) define(name string) error {
+	if s.messages[name] != nil || s.enums[name] != nil {
+		return fmt.Errorf("duplicate definition of %q", name)
+	}
+	return nil
+}
+
+// resolve resolves the field types of m and its nested types, and indexes
+// its fields. If packed is true, repeated scalar fields are packed unless
+// they say otherwise.
+func (s *Schema) resolve(m *MessageDesc, packed bool) error {
+	m.byNumber = make(map[int]*FieldDesc)
+	m.byName = make(map[string]*FieldDesc)
+	for _, f := range m.Fields {
+		if m.byNumber[f.Number] != nil {
+			return fmt.Errorf("%s: duplicate field number %d", m.FullName, f.Number)
+		} else if m.byName[f.Name] != nil {
+			return fmt.Errorf("%s: duplicate field name %q", m.FullName, f.Name)
+		}
+		m.byNumber[f.Number] = f
+		m.byName[f.Name] = f
+
+		if f.TypeName != "" {
+			if err := s.resolveField(m.FullName, f); err != nil {
+				return fmt.Errorf("%s.%s: %w", m.FullName, f.Name, err)
+			}
+		} else if f.Type == 0 {
+			return fmt.Errorf("%s.%s: missing type", m.FullName, f.Name)
+		}
+		if f.Type == TypeGroup && f.Message != nil && m.byName[f.Message.Name] == nil {
+			m.byName[f.Message.Name] = f
+		}
+		f.packed = f.IsRepeated() && f.Type.IsScalar() && (packed && f.Packed == nil || f.Packed != nil && *f.Packed)
+	}
+	for _, nm := range m.Nested {
+		if err := s.resolve(nm, packed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveField finds the type named by f.TypeName, beginning in the given
+// scope and working outward.
+func (s *Schema) resolveField(scope string, f *FieldDesc) error {
+	name := f.TypeName
+	if full, ok := strings.CutPrefix(name, "."); ok {
+		return s.setType(f, full)
+	}
+	for {
+		full := qualify(scope, name)
+		if s.messages[full] != nil || s.enums[full] != nil {
+			return s.setType(f, full)
+		} else if scope == "" {
+			return fmt.Errorf("unknown type %q", name)
+		}
+		scope, _ = cutLast(scope)
+	}
+}
+
+func (s *Schema) setType(f *FieldDesc, full string) error {
+	if m := s.messages[full]; m != nil {
+		if f.Type == 0 {
+			f.Type = TypeMessage
+		} else if f.Type != TypeMessage && f.Type != TypeGroup {
+			return fmt.Errorf("type %q is a message, not %v", full, f.Type)
+		}
+		f.Message = m
+	} else if e := s.enums[full]; e != nil {
+		if f.Type == 0 {
+			f.Type = TypeEnum
+		} else if f.Type != TypeEnum {
+			return fmt.Errorf("type %q is an enum, not %v", full, f.Type)
+		}
+		f.Enum = e
+	} else {
+		return fmt.Errorf("unknown type %q", full)
+	}
+	f.TypeName = "." + full
+	return nil
+}
+
+// qualify returns name qualified by the given scope.
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// cutLast splits a dotted name into its scope and its last component.
+func cutLast(name string) (scope, last string) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"testing"
+
+	"github.com/creachadair/pson/wirepb"
+)
+
+func TestSchemaResolve(t *testing.T) {
+	// Type names without a leading dot are resolved from the innermost scope
+	// outward, and fields without a type take the kind of their type.
+	inner := &wirepb.MessageDesc{Name: "Inner", Fields: []*wirepb.FieldDesc{
+		{Name: "x", Number: 1, TypeName: "Kind"},
+		{Name: "y", Number: 2, TypeName: "Outer"},
+	}}
+	outer := &wirepb.MessageDesc{
+		Name:   "Outer",
+		Nested: []*wirepb.MessageDesc{inner},
+		Enums:  []*wirepb.EnumDesc{{Name: "Kind"}},
+		Fields: []*wirepb.FieldDesc{{Name: "i", Number: 1, TypeName: "Inner"}},
+	}
+	other := &wirepb.MessageDesc{Name: "Other", Fields: []*wirepb.FieldDesc{
+		{Name: "o", Number: 1, TypeName: "a.b.Outer.Inner"},
+	}}
+	s, err := wirepb.NewSchema(
+		&wirepb.FileDesc{Name: "a.proto", Package: "a.b", Messages: []*wirepb.MessageDesc{outer}},
+		&wirepb.FileDesc{Name: "c.proto", Package: "c", Messages: []*wirepb.MessageDesc{other}},
+	)
+	if err != nil {
+		t.Fatalf("NewSchema: unexpected error: %v", err)
+	}
+	tests := []struct {
+		field    *wirepb.FieldDesc
+		typ      wirepb.Type
+		typeName string
+	}{
+		{inner.FieldByName("x"), wirepb.TypeEnum, ".a.b.Outer.Kind"},
+		{inner.FieldByName("y"), wirepb.TypeMessage, ".a.b.Outer"},
+		{outer.FieldByName("i"), wirepb.TypeMessage, ".a.b.Outer.Inner"},
+		{other.FieldByName("o"), wirepb.TypeMessage, ".a.b.Outer.Inner"},
+	}
+	for _, test := range tests {
+		if test.field.Type != test.typ || test.field.TypeName != test.typeName {
+			t.Errorf("Field %q: got %v %q, want %v %q", test.field.Name,
+				test.field.Type, test.field.TypeName, test.typ, test.typeName)
+		}
+	}
+	if got := s.Message("a.b.Outer.Inner"); got != inner {
+		t.Errorf("Message a.b.Outer.Inner: got %+v, want %+v", got, inner)
+	}
+
+	if _, err := wirepb.NewSchema(&wirepb.FileDesc{Messages: []*wirepb.MessageDesc{
+		{Name: "M", Fields: []*wirepb.FieldDesc{{Name: "x", Number: 1}}},
+	}}); err == nil {
+		t.Error("NewSchema with untyped field: got nil, want error")
+	}
+}
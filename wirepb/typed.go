@@ -0,0 +1,213 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+// Decode decodes data as a wire-format message of type m, and returns it as a
+// textpb.Message whose fields are named as in the schema. Values are rendered
+// as in text format: Numbers in decimal, enum values by name, and strings and
+// bytes as strings. A packed field yields one value per element.
+//
+// A field whose number is not defined by m, or whose wire type does not match
+// its definition, is decoded as by DecodeRaw, and named by its number. It is
+// an error for messages to be nested more than 100 deep.
+func (m *MessageDesc) Decode(data []byte) (textpb.Message, error) { return m.decode(data, 0) }
+
+var errMessageDepth = fmt.Errorf("messages nested more than %d deep", maxGroupDepth)
+
+// decode decodes data as for Decode. The depth is the number of messages
+// enclosing data.
+func (m *MessageDesc) decode(data []byte, depth int) (textpb.Message, error) {
+	msg := textpb.Message{}
+	dec := NewBytesDecoder(data)
+	for {
+		f, err := dec.Next()
+		if err == io.EOF {
+			return msg, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.FullName, err)
+		} else if f.ID <= 0 || f.ID > maxFieldID {
+			return nil, fmt.Errorf("%s: invalid field number %d", m.FullName, f.ID)
+		}
+
+		fd := m.FieldByNumber(f.ID)
+		if fd == nil || !fd.accepts(f.Wire) {
+			msg = append(msg, &textpb.Field{Name: strconv.Itoa(f.ID), Values: rawValues(f, depth)})
+			continue
+		}
+		vals, err := fd.decode(f, depth)
+		if err == errMessageDepth {
+			return nil, err // not wrapped at each level
+		} else if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", m.FullName, fd.Name, err)
+		}
+		msg = append(msg, &textpb.Field{Name: fd.Name, Values: vals})
+	}
+}
+
+// accepts reports whether a value of fd may have wire type w. A repeated
+// scalar field may be packed or not, regardless of its declaration.
+func (fd *FieldDesc) accepts(w WireType) bool {
+	return w == fd.Type.Wire() || (w == TDelimited && fd.IsRepeated() && fd.Type.IsScalar())
+}
+
+// decode returns the values of field f, whose definition is fd, in a message
+// with the given depth.
+func (fd *FieldDesc) decode(f *Field, depth int) ([]*textpb.Value, error) {
+	if f.Wire != TDelimited || !fd.Type.IsScalar() {
+		v, err := fd.decodeValue(f, depth)
+		if err != nil {
+			return nil, err
+		}
+		return []*textpb.Value{v}, nil
+	}
+
+	// Reaching here, f is a packed field. Decode each element as a field of
+	// its own.
+	var elts []*Field
+	switch fd.Type.Wire() {
+	case TVarint:
+		vs, err := UnpackVarints(f.Data)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vs {
+			elts = append(elts, &Field{ID: f.ID, Wire: TVarint, Data: PutUint64(v)})
+		}
+	case TFixed32, TFixed64:
+		n := 4
+		if fd.Type.Wire() == TFixed64 {
+			n = 8
+		}
+		if len(f.Data)%n != 0 {
+			return nil, fmt.Errorf("packed %v length %d is not a multiple of %d", fd.Type, len(f.Data), n)
+		}
+		for i := 0; i < len(f.Data); i += n {
+			elts = append(elts, &Field{ID: f.ID, Wire: fd.Type.Wire(), Data: f.Data[i : i+n]})
+		}
+	}
+	vals := make([]*textpb.Value, len(elts))
+	for i, elt := range elts {
+		v, err := fd.decodeValue(elt, depth)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// decodeValue decodes a single value of field f, whose definition is fd, in a
+// message with the given depth.
+func (fd *FieldDesc) decodeValue(f *Field, depth int) (*textpb.Value, error) {
+	var text string
+	var err error
+	switch fd.Type {
+	case TypeDouble:
+		var v float64
+		v, err = f.AsDouble()
+		return floatValue(v, 64), err
+	case TypeFloat:
+		var v float32
+		v, err = f.AsFloat()
+		return floatValue(float64(v), 32), err
+	case TypeInt64:
+		var v int64
+		v, err = f.AsInt64()
+		text = strconv.FormatInt(v, 10)
+	case TypeUint64:
+		var v uint64
+		v, err = f.AsUint64()
+		text = strconv.FormatUint(v, 10)
+	case TypeInt32:
+		var v int32
+		v, err = f.AsInt32()
+		text = strconv.FormatInt(int64(v), 10)
+	case TypeFixed64:
+		var v uint64
+		v, err = f.AsFixed64()
+		text = strconv.FormatUint(v, 10)
+	case TypeFixed32:
+		var v uint32
+		v, err = f.AsFixed32()
+		text = strconv.FormatUint(uint64(v), 10)
+	case TypeBool:
+		var v bool
+		if v, err = f.AsBool(); v {
+			return &textpb.Value{Type: textpb.True, Text: "true"}, err
+		}
+		return &textpb.Value{Type: textpb.False, Text: "false"}, err
+	case TypeString, TypeBytes:
+		var v []byte
+		v, err = f.AsBytes()
+		return &textpb.Value{Type: textpb.String, Text: string(v)}, err
+	case TypeGroup, TypeMessage:
+		if fd.Message == nil {
+			return nil, fmt.Errorf("unresolved type %q", fd.TypeName)
+		} else if depth >= maxGroupDepth {
+			return nil, errMessageDepth
+		}
+		msg, err := fd.Message.decode(f.Data, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &textpb.Value{Msg: msg}, nil
+	case TypeUint32:
+		var v uint32
+		v, err = f.AsUint32()
+		text = strconv.FormatUint(uint64(v), 10)
+	case TypeEnum:
+		var v int32
+		v, err = f.AsInt32()
+		if fd.Enum != nil {
+			if ev := fd.Enum.ValueByNumber(v); ev != nil {
+				return &textpb.Value{Type: textpb.Name, Text: ev.Name}, err
+			}
+		}
+		text = strconv.FormatInt(int64(v), 10)
+	case TypeSfixed32:
+		var v int32
+		v, err = f.AsSfixed32()
+		text = strconv.FormatInt(int64(v), 10)
+	case TypeSfixed64:
+		var v int64
+		v, err = f.AsSfixed64()
+		text = strconv.FormatInt(v, 10)
+	case TypeSint32:
+		var v int32
+		v, err = f.AsSint32()
+		text = strconv.FormatInt(int64(v), 10)
+	case TypeSint64:
+		var v int64
+		v, err = f.AsSint64()
+		text = strconv.FormatInt(v, 10)
+	default:
+		return nil, fmt.Errorf("unknown field type %v", fd.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &textpb.Value{Type: textpb.Number, Text: text}, nil
+}
+
+// floatValue returns a value for the floating-point number v, with the given
+// precision in bits.
+func floatValue(v float64, bits int) *textpb.Value {
+	switch {
+	case math.IsInf(v, 1):
+		return &textpb.Value{Type: textpb.Name, Text: "inf"}
+	case math.IsInf(v, -1):
+		return &textpb.Value{Type: textpb.Number, Text: "-inf"}
+	case math.IsNaN(v):
+		return &textpb.Value{Type: textpb.Name, Text: "nan"}
+	}
+	return &textpb.Value{Type: textpb.Number, Text: strconv.FormatFloat(v, 'g', -1, bits)}
+}
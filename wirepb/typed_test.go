@@ -0,0 +1,243 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/creachadair/pson/textpb/format"
+	"github.com/creachadair/pson/wirepb"
+)
+
+// A pb is a message under construction for a test, encoded with an Encoder.
+type pb func(*wirepb.Encoder) error
+
+func msg(id int, fields ...pb) pb {
+	return func(e *wirepb.Encoder) error {
+		if err := e.BeginMessage(id); err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if err := f(e); err != nil {
+				return err
+			}
+		}
+		return e.EndMessage()
+	}
+}
+
+func str(id int, s string) pb   { return func(e *wirepb.Encoder) error { return e.String(id, s) } }
+func num(id int, v uint64) pb   { return func(e *wirepb.Encoder) error { return e.Varint(id, v) } }
+func raw(id int, s string) pb   { return func(e *wirepb.Encoder) error { return e.Bytes(id, []byte(s)) } }
+func fix32(id int, v uint32) pb { return func(e *wirepb.Encoder) error { return e.Fixed32(id, v) } }
+func fix64(id int, v uint64) pb { return func(e *wirepb.Encoder) error { return e.Fixed64(id, v) } }
+
+func encode(t *testing.T, fields ...pb) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := wirepb.NewEncoder(&buf)
+	for _, f := range fields {
+		if err := f(enc); err != nil {
+			t.Fatalf("Encoding failed: %v", err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Field descriptor helpers, using the field numbers of descriptor.proto.
+func field(name string, number int, label wirepb.Label, typ wirepb.Type, more ...pb) pb {
+	return msg(2, append([]pb{str(1, name), num(3, uint64(number)), num(4, uint64(label)), num(5, uint64(typ))}, more...)...)
+}
+func typeName(name string) pb { return str(6, name) }
+
+// testSchema returns a descriptor set equivalent to:
+//
+//	// test.proto
+//	syntax = "proto3";
+//	package pkg;
+//	enum Color { RED = 0; GREEN = 1; }
+//	message Msg {
+//	  message Inner { float x = 1; }
+//	  int32 i = 1;
+//	  sint64 s = 2;
+//	  string name = 3;
+//	  repeated int32 nums = 4;
+//	  Color c = 5;
+//	  Inner inner = 6;
+//	  double d = 7;
+//	  bool b = 8;
+//	  bytes data = 9;
+//	  map<string, int32> m = 10;
+//	  sfixed32 f = 11;
+//	  repeated fixed64 ff = 12 [packed = false];
+//	}
+//
+//	// old.proto
+//	syntax = "proto2";
+//	package old;
+//	message Old {
+//	  optional group G = 1 { optional int32 a = 2; }
+//	  repeated uint32 r = 3;
+//	}
+func testSchema(t *testing.T) []byte {
+	const opt, rep = wirepb.LabelOptional, wirepb.LabelRepeated
+	return encode(t,
+		msg(1, // FileDescriptorSet.file
+			str(1, "test.proto"), str(2, "pkg"), str(12, "proto3"),
+			msg(5, str(1, "Color"), msg(2, str(1, "RED"), num(2, 0)), msg(2, str(1, "GREEN"), num(2, 1))),
+			msg(4, str(1, "Msg"),
+				msg(3, str(1, "Inner"), field("x", 1, opt, wirepb.TypeFloat)),
+				msg(3, str(1, "MEntry"), msg(7, num(7, 1)),
+					field("key", 1, opt, wirepb.TypeString),
+					field("value", 2, opt, wirepb.TypeInt32)),
+				field("i", 1, opt, wirepb.TypeInt32),
+				field("s", 2, opt, wirepb.TypeSint64),
+				field("name", 3, opt, wirepb.TypeString),
+				field("nums", 4, rep, wirepb.TypeInt32),
+				field("c", 5, opt, wirepb.TypeEnum, typeName(".pkg.Color")),
+				field("inner", 6, opt, wirepb.TypeMessage, typeName(".pkg.Msg.Inner")),
+				field("d", 7, opt, wirepb.TypeDouble),
+				field("b", 8, opt, wirepb.TypeBool),
+				field("data", 9, opt, wirepb.TypeBytes),
+				field("m", 10, rep, wirepb.TypeMessage, typeName(".pkg.Msg.MEntry")),
+				field("f", 11, opt, wirepb.TypeSfixed32),
+				field("ff", 12, rep, wirepb.TypeFixed64, msg(8, num(2, 0))),
+			),
+		),
+		msg(1,
+			str(1, "old.proto"), str(2, "old"),
+			msg(4, str(1, "Old"),
+				msg(3, str(1, "G"), field("a", 2, opt, wirepb.TypeInt32)),
+				field("g", 1, opt, wirepb.TypeGroup, typeName(".old.Old.G")),
+				field("r", 3, rep, wirepb.TypeUint32),
+			),
+		),
+	)
+}
+
+func TestReadSchema(t *testing.T) {
+	s, err := wirepb.ReadSchema(bytes.NewReader(testSchema(t)))
+	if err != nil {
+		t.Fatalf("ReadSchema: unexpected error: %v", err)
+	}
+	m := s.Message("pkg.Msg")
+	if m == nil {
+		t.Fatal("Message pkg.Msg not found")
+	}
+	if f := m.FieldByName("nums"); f == nil || !f.IsPacked() {
+		t.Errorf("Field nums: got %+v, want packed", f)
+	}
+	if f := m.FieldByName("ff"); f == nil || f.IsPacked() {
+		t.Errorf("Field ff: got %+v, want not packed", f)
+	}
+	if f := m.FieldByNumber(5); f == nil || f.Enum != s.Enum(".pkg.Color") {
+		t.Errorf("Field 5: got %+v, want enum pkg.Color", f)
+	}
+	if f := s.Message("old.Old").FieldByName("G"); f == nil || f.Name != "g" {
+		t.Errorf("Field G: got %+v, want group g", f)
+	}
+	if f := s.Message("old.Old").FieldByName("r"); f == nil || f.IsPacked() {
+		t.Errorf("Field r: got %+v, want not packed", f)
+	}
+}
+
+func TestDecodeTyped(t *testing.T) {
+	s, err := wirepb.ReadSchema(bytes.NewReader(testSchema(t)))
+	if err != nil {
+		t.Fatalf("ReadSchema: unexpected error: %v", err)
+	}
+	tests := []struct {
+		typ   string
+		input []byte
+		want  string
+	}{
+		{"pkg.Msg", nil, ""},
+		{"pkg.Msg", encode(t, num(1, math.MaxUint64), num(2, 3), str(3, "hi")), `i:-1 s:-2 name:"hi"`},
+		{"pkg.Msg", encode(t, raw(4, "\001\002\226\001"), num(4, 5)), `nums:1 nums:2 nums:150 nums:5`},
+		{"pkg.Msg", encode(t, num(5, 1), num(5, 7)), `c:GREEN c:7`},
+		{"pkg.Msg", encode(t, msg(6, fix32(1, math.Float32bits(1.5)))), `inner {x:1.5}`},
+		{"pkg.Msg", encode(t, fix64(7, math.Float64bits(math.Inf(-1))), fix64(7, math.Float64bits(0.1))), `d:-inf d:0.1`},
+		{"pkg.Msg", encode(t, num(8, 1), num(8, 0), raw(9, "\000\377")), `b:true b:false data:"\000\377"`},
+		{"pkg.Msg", encode(t, msg(10, str(1, "k"), num(2, 3))), `m {key:"k" value:3}`},
+		{"pkg.Msg", encode(t, fix32(11, math.MaxUint32), fix64(12, 1), raw(12, "\002\000\000\000\000\000\000\000")), `f:-1 ff:1 ff:2`},
+
+		// Unknown fields and mismatched wire types are decoded raw.
+		{"pkg.Msg", encode(t, num(99, 1), num(3, 2)), `99:1 3:2`},
+
+		// Groups are decoded as messages.
+		{"old.Old", encode(t, func(e *wirepb.Encoder) error {
+			return e.Field(&wirepb.Field{ID: 1, Wire: wirepb.TStartGroup, Data: []byte("\020\001")})
+		}, num(3, 4)), `g {a:1} r:4`},
+	}
+	cfg := format.Config{Compact: true, Curly: true}
+	for _, test := range tests {
+		msg, err := s.Message(test.typ).Decode(test.input)
+		if err != nil {
+			t.Errorf("Decode %q: unexpected error: %v", test.input, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := cfg.Text(&buf, msg); err != nil {
+			t.Errorf("Text %q: unexpected error: %v", test.input, err)
+		} else if got := buf.String(); got != test.want {
+			t.Errorf("Decode %q: got %#q, want %#q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestDecodeDepth(t *testing.T) {
+	s, err := wirepb.NewSchema(&wirepb.FileDesc{
+		Name:    "node.proto",
+		Package: "p",
+		Messages: []*wirepb.MessageDesc{{
+			Name: "Node",
+			Fields: []*wirepb.FieldDesc{{
+				Name: "child", Number: 1, Label: wirepb.LabelOptional, TypeName: "Node", OneofIndex: -1,
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewSchema: unexpected error: %v", err)
+	}
+	m := s.Message("p.Node")
+	if _, err := m.Decode(nested(100)); err != nil {
+		t.Errorf("Decode: 100 nested messages: unexpected error: %v", err)
+	}
+	if _, err := m.Decode(nested(101)); err == nil {
+		t.Error("Decode: 101 nested messages: got nil, want error")
+	}
+	if _, err := m.Decode(nested(4 << 20)); err == nil {
+		t.Error("Decode: deeply nested messages: got nil, want error")
+	} else {
+		t.Logf("Decode: got expected error: %v", err)
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	const opt = wirepb.LabelOptional
+	tests := []struct {
+		desc  string
+		input []byte
+	}{
+		{"malformed", []byte("\012\005\012")},
+		{"unknown type", encode(t, msg(1, msg(4, str(1, "M"),
+			field("x", 1, opt, wirepb.TypeMessage, typeName(".Nope")))))},
+		{"duplicate type", encode(t, msg(1, msg(4, str(1, "M")), msg(5, str(1, "M"))))},
+		{"duplicate number", encode(t, msg(1, msg(4, str(1, "M"),
+			field("x", 1, opt, wirepb.TypeInt32), field("y", 1, opt, wirepb.TypeInt32))))},
+		{"enum as message", encode(t, msg(1, msg(5, str(1, "E")), msg(4, str(1, "M"),
+			field("x", 1, opt, wirepb.TypeMessage, typeName("E")))))},
+	}
+	for _, test := range tests {
+		if _, err := wirepb.ReadSchema(bytes.NewReader(test.input)); err == nil {
+			t.Errorf("ReadSchema %s: got nil, want error", test.desc)
+		} else {
+			t.Logf("ReadSchema %s: got expected error: %v", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/creachadair/pson/textpb"
+)
+
+// Encode encodes msg as a wire-format message of type m. The fields of msg
+// are found by name, or by number for a field whose name is a decimal integer
+// not otherwise defined. Values are checked against the declared types of
+// their fields: Integers must be in range, enum values may be given by name
+// or number, and strings must be valid UTF-8. As in the proto3 JSON mapping,
+// enum names, 64-bit integers, and floating-point values may also be given as
+// strings, so that the output of ParseJSON can be encoded.
+//
+// Fields are written in order of field number, and repeated fields in the
+// order of their values. The values of a packed field are written as a single
+// field. A field that is not repeated may have only one value.
+func (m *MessageDesc) Encode(msg textpb.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := m.encode(e, msg); err != nil {
+		return nil, err
+	} else if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encode encodes the fields of msg to e.
+func (m *MessageDesc) encode(e *Encoder, msg textpb.Message) error {
+	// Collect the values of each field, in order of field number.
+	type entry struct {
+		fd   *FieldDesc
+		vals []*textpb.Value
+	}
+	var entries []*entry
+	byNumber := make(map[int]*entry)
+	for _, f := range msg {
+		fd, err := m.fieldNamed(f.Name)
+		if err != nil {
+			return err
+		}
+		ent := byNumber[fd.Number]
+		if ent == nil {
+			ent = &entry{fd: fd}
+			byNumber[fd.Number] = ent
+			entries = append(entries, ent)
+		}
+		ent.vals = append(ent.vals, f.Values...)
+	}
+	slices.SortStableFunc(entries, func(a, b *entry) int { return a.fd.Number - b.fd.Number })
+
+	for _, ent := range entries {
+		fd := ent.fd
+		if len(ent.vals) > 1 && !fd.IsRepeated() {
+			return fmt.Errorf("%s.%s: field is not repeated, but has %d values", m.FullName, fd.Name, len(ent.vals))
+		}
+		var err error
+		if fd.IsPacked() {
+			err = fd.encodePacked(e, ent.vals)
+		} else {
+			for _, v := range ent.vals {
+				if err = fd.encodeValue(e, v); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", m.FullName, fd.Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldNamed returns the field of m with the given name.
+func (m *MessageDesc) fieldNamed(name string) (*FieldDesc, error) {
+	if fd := m.FieldByName(name); fd != nil {
+		return fd, nil
+	} else if n, err := strconv.Atoi(name); err == nil {
+		if fd := m.FieldByNumber(n); fd != nil {
+			return fd, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unknown field %q", m.FullName, name)
+}
+
+// encodeValue encodes v as a single value of field fd.
+func (fd *FieldDesc) encodeValue(e *Encoder, v *textpb.Value) error {
+	switch fd.Type {
+	case TypeMessage, TypeGroup:
+		if v.Msg == nil {
+			return fmt.Errorf("got %s, want a message", valueKind(v))
+		} else if fd.Message == nil {
+			return fmt.Errorf("unresolved type %q", fd.TypeName)
+		}
+		if fd.Type == TypeMessage {
+			if err := e.BeginMessage(fd.Number); err != nil {
+				return err
+			} else if err := fd.Message.encode(e, v.Msg); err != nil {
+				return err
+			}
+			return e.EndMessage()
+		}
+		data, err := fd.Message.Encode(v.Msg)
+		if err != nil {
+			return err
+		}
+		return e.Field(&Field{ID: fd.Number, Wire: TStartGroup, Data: data})
+
+	case TypeString, TypeBytes:
+		if v.Msg != nil || v.Type != textpb.String {
+			return fmt.Errorf("got %s, want a string", valueKind(v))
+		} else if fd.Type == TypeString && !utf8.ValidString(v.Text) {
+			return fmt.Errorf("string %q is not valid UTF-8", v.Text)
+		}
+		return e.String(fd.Number, v.Text)
+	}
+
+	data, err := fd.scalar(nil, v)
+	if err != nil {
+		return err
+	}
+	f := &Field{ID: fd.Number, Wire: fd.Type.Wire(), Data: data}
+	if f.Wire == TVarint {
+		f.Data = PutUint64(Uint64(data))
+	}
+	return e.Field(f)
+}
+
+// encodePacked encodes vals as the packed values of field fd.
+func (fd *FieldDesc) encodePacked(e *Encoder, vals []*textpb.Value) error {
+	if len(vals) == 0 {
+		return nil // nothing to write
+	}
+	var buf []byte
+	for _, v := range vals {
+		var err error
+		if buf, err = fd.scalar(buf, v); err != nil {
+			return err
+		}
+	}
+	if fd.Type.Wire() == TVarint {
+		// The scalar encoding of a varint is fixed-width; rewrite it.
+		words := make([]uint64, len(buf)/8)
+		for i := range words {
+			words[i] = binary.BigEndian.Uint64(buf[8*i:])
+		}
+		buf = PackVarints(nil, words)
+	}
+	return e.Bytes(fd.Number, buf)
+}
+
+// scalar appends the encoding of v as a value of the scalar type of fd to
+// buf. Fixed-width types are appended in their wire encoding; varint types
+// are appended as 8-byte big-endian words.
+func (fd *FieldDesc) scalar(buf []byte, v *textpb.Value) ([]byte, error) {
+	if v.Msg != nil {
+		return nil, fmt.Errorf("got a message, want %v", fd.Type)
+	}
+	var word uint64
+	switch fd.Type {
+	case TypeDouble:
+		fp, err := floatValueOf(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(fp)), nil
+	case TypeFloat:
+		fp, err := floatValueOf(v, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(fp))), nil
+	case TypeInt64, TypeSfixed64, TypeSint64:
+		z, err := intValueOf(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		word = uint64(z)
+		if fd.Type == TypeSint64 {
+			word = uint64(z<<1) ^ uint64(z>>63)
+		}
+	case TypeInt32, TypeSfixed32, TypeSint32:
+		z, err := intValueOf(v, 32)
+		if err != nil {
+			return nil, err
+		}
+		word = uint64(z)
+		if fd.Type == TypeSint32 {
+			word = uint64(uint32(int32(z)<<1) ^ uint32(int32(z)>>31))
+		}
+	case TypeUint64, TypeFixed64:
+		u, err := uintValueOf(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		word = u
+	case TypeUint32, TypeFixed32:
+		u, err := uintValueOf(v, 32)
+		if err != nil {
+			return nil, err
+		}
+		word = u
+	case TypeBool:
+		b, err := boolValueOf(v)
+		if err != nil {
+			return nil, err
+		} else if b {
+			word = 1
+		}
+	case TypeEnum:
+		z, err := fd.enumValueOf(v)
+		if err != nil {
+			return nil, err
+		}
+		word = uint64(int64(z))
+	default:
+		return nil, fmt.Errorf("type %v is not scalar", fd.Type)
+	}
+	switch fd.Type.Wire() {
+	case TFixed32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(word)), nil
+	case TFixed64:
+		return binary.LittleEndian.AppendUint64(buf, word), nil
+	}
+	return binary.BigEndian.AppendUint64(buf, word), nil
+}
+
+// valueKind describes the kind of v for an error message.
+func valueKind(v *textpb.Value) string {
+	if v.Msg != nil {
+		return "a message"
+	}
+	return fmt.Sprintf("%v %q", v.Type, v.Text)
+}
+
+// integerBase returns the base in which to parse v as an integer of the given
+// size. A value of a 64-bit type may be a string of decimal digits, as in the
+// proto3 JSON mapping.
+func integerBase(v *textpb.Value, bits int) (int, error) {
+	if v.Type == textpb.Number {
+		return 0, nil
+	} else if v.Type == textpb.String && bits == 64 {
+		return 10, nil
+	}
+	return 0, fmt.Errorf("got %s, want an integer", valueKind(v))
+}
+
+func intValueOf(v *textpb.Value, bits int) (int64, error) {
+	base, err := integerBase(v, bits)
+	if err != nil {
+		return 0, err
+	}
+	z, err := strconv.ParseInt(v.Text, base, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid int%d value %q", bits, v.Text)
+	}
+	return z, nil
+}
+
+func uintValueOf(v *textpb.Value, bits int) (uint64, error) {
+	base, err := integerBase(v, bits)
+	if err != nil {
+		return 0, err
+	}
+	u, err := strconv.ParseUint(v.Text, base, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uint%d value %q", bits, v.Text)
+	}
+	return u, nil
+}
+
+func floatValueOf(v *textpb.Value, bits int) (float64, error) {
+	if v.Type != textpb.Number && v.Type != textpb.Name && v.Type != textpb.String {
+		return 0, fmt.Errorf("got %s, want a number", valueKind(v))
+	}
+	fp, err := v.Number()
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", v.Text)
+	} else if bits == 32 && !math.IsInf(fp, 0) && math.Abs(fp) > math.MaxFloat32 {
+		return 0, fmt.Errorf("number %q out of range for float", v.Text)
+	}
+	return fp, nil
+}
+
+func boolValueOf(v *textpb.Value) (bool, error) {
+	switch {
+	case v.Type == textpb.True:
+		return true, nil
+	case v.Type == textpb.False:
+		return false, nil
+	case v.Type == textpb.Number && v.Text == "1":
+		return true, nil
+	case v.Type == textpb.Number && v.Text == "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("got %s, want a bool", valueKind(v))
+}
+
+func (fd *FieldDesc) enumValueOf(v *textpb.Value) (int32, error) {
+	switch v.Type {
+	case textpb.Number:
+		z, err := intValueOf(v, 32)
+		return int32(z), err
+	case textpb.Name, textpb.String:
+		if fd.Enum == nil {
+			return 0, fmt.Errorf("unresolved type %q", fd.TypeName)
+		} else if ev := fd.Enum.ValueByName(v.Text); ev != nil {
+			return ev.Number, nil
+		}
+		return 0, fmt.Errorf("unknown value %q for enum %s", v.Text, fd.Enum.FullName)
+	}
+	return 0, fmt.Errorf("got %s, want an enum value", valueKind(v))
+}
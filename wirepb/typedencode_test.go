@@ -0,0 +1,155 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/creachadair/pson/textpb"
+	"github.com/creachadair/pson/textpb/format"
+	"github.com/creachadair/pson/wirepb"
+)
+
+func TestEncodeTyped(t *testing.T) {
+	s, err := wirepb.ReadSchema(bytes.NewReader(testSchema(t)))
+	if err != nil {
+		t.Fatalf("ReadSchema: unexpected error: %v", err)
+	}
+	tests := []struct {
+		typ, input string
+		want       []byte
+	}{
+		{"pkg.Msg", ``, nil},
+		{"pkg.Msg", `name: "hi" i: -1 s: -2`, encode(t, num(1, 1<<64-1), num(2, 3), str(3, "hi"))},
+		{"pkg.Msg", `nums: [1, 2] c: GREEN nums: 0x96`, encode(t, raw(4, "\001\002\226\001"), num(5, 1))},
+		{"pkg.Msg", `c: 7 inner { x: 1.5f } d: -inf`, encode(t, num(5, 7), msg(6, fix32(1, 0x3fc00000)), fix64(7, 0xfff0000000000000))},
+		{"pkg.Msg", `b: true data: "\000\377" m { key: "k" value: 3 } m {}`,
+			encode(t, num(8, 1), raw(9, "\000\377"), msg(10, str(1, "k"), num(2, 3)), msg(10))},
+		{"pkg.Msg", `f: -1 ff: 1 ff: 2`, encode(t, fix32(11, 1<<32-1), fix64(12, 1), fix64(12, 2))},
+		{"old.Old", `r: 4 g { a: 1 } r: 5`, encode(t, func(e *wirepb.Encoder) error {
+			return e.Field(&wirepb.Field{ID: 1, Wire: wirepb.TStartGroup, Data: []byte("\020\001")})
+		}, num(3, 4), num(3, 5))},
+		{"old.Old", `G { a: 1 }`, encode(t, func(e *wirepb.Encoder) error {
+			return e.Field(&wirepb.Field{ID: 1, Wire: wirepb.TStartGroup, Data: []byte("\020\001")})
+		})},
+	}
+	cfg := format.Config{Compact: true, Curly: true}
+	for _, test := range tests {
+		in, err := textpb.ParseString(test.input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", test.input, err)
+		}
+		m := s.Message(test.typ)
+		got, err := m.Encode(in)
+		if err != nil {
+			t.Errorf("Encode %#q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("Encode %#q:\n got %q\nwant %q", test.input, got, test.want)
+		}
+
+		// The encoding must decode to an equivalent message.
+		back, err := m.Decode(got)
+		if err != nil {
+			t.Errorf("Decode %q: unexpected error: %v", got, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := cfg.Text(&buf, back); err != nil {
+			t.Errorf("Text: unexpected error: %v", err)
+		}
+		t.Logf("Round trip %#q: %s", test.input, buf.String())
+	}
+
+	// Fields may be named by number, as in the output of DecodeRaw.
+	in := textpb.Message{
+		{Name: "4", Values: []*textpb.Value{{Type: textpb.Number, Text: "3"}}},
+		{Name: "1", Values: []*textpb.Value{{Type: textpb.Number, Text: "0"}}},
+	}
+	if got, err := s.Message("pkg.Msg").Encode(in); err != nil {
+		t.Errorf("Encode %v: unexpected error: %v", in, err)
+	} else if want := encode(t, num(1, 0), raw(4, "\003")); !bytes.Equal(got, want) {
+		t.Errorf("Encode %v: got %q, want %q", in, got, want)
+	}
+	in[0].Name = "99"
+	if got, err := s.Message("pkg.Msg").Encode(in); err == nil {
+		t.Errorf("Encode %v: got %q, want error", in, got)
+	}
+}
+
+func TestEncodeTypedErrors(t *testing.T) {
+	s, err := wirepb.ReadSchema(bytes.NewReader(testSchema(t)))
+	if err != nil {
+		t.Fatalf("ReadSchema: unexpected error: %v", err)
+	}
+	m := s.Message("pkg.Msg")
+	tests := []string{
+		`nope: 1`,                // unknown field
+		`i: 1 i: 2`,              // not repeated
+		`i: 2147483648`,          // out of range
+		`i: 1.5`,                 // not an integer
+		`i: "1"`,                 // not a number
+		`i { }`,                  // not a scalar
+		`nums: [1, -2147483649]`, // packed value out of range
+		`ff: -1`,                 // negative unsigned
+		`s: x`,                   // not a number
+		`c: BLUE`,                // unknown enum value
+		`c: "BLUE"`,              // unknown enum value
+		`c: true`,                // not an enum value
+		`s: "0x10"`,              // not a decimal string
+		`inner: 1`,               // not a message
+		`inner { x: 1e39 }`,      // float out of range
+		`inner { y: 1 }`,         // unknown nested field
+		`name: 5`,                // not a string
+		`name: "\377"`,           // invalid UTF-8
+		`b: 2`,                   // not a bool
+		`d: nope`,                // not a number
+		`[ext.field] {}`,         // extensions are not supported
+		`m { key: 1 }`,           // wrong type in map entry
+	}
+	for _, input := range tests {
+		in, err := textpb.ParseString(input)
+		if err != nil {
+			t.Fatalf("[BROKEN TEST] Parsing %q failed: %v", input, err)
+		}
+		if got, err := m.Encode(in); err == nil {
+			t.Errorf("Encode %#q: got %q, want error", input, got)
+		} else {
+			t.Logf("Encode %#q: got expected error: %v", input, err)
+		}
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	s, err := wirepb.ReadSchema(bytes.NewReader(testSchema(t)))
+	if err != nil {
+		t.Fatalf("ReadSchema: unexpected error: %v", err)
+	}
+	m := s.Message("pkg.Msg")
+	want := encode(t, num(1, 7), num(2, 24691357802), str(3, "hi"), raw(4, "\001\002"),
+		num(5, 1), msg(6, fix32(1, 0x3fc00000)), fix64(7, 0xfff0000000000000), num(8, 1),
+		msg(10, str(1, "k"), num(2, 3)), fix64(12, 1<<40))
+
+	// Wire format decoded and written as JSON must encode to the same bytes.
+	for _, opts := range []textpb.JSONOptions{{}, textpb.Proto3JSON} {
+		in, err := m.Decode(want)
+		if err != nil {
+			t.Fatalf("Decode: unexpected error: %v", err)
+		}
+		js, err := opts.Marshal(in)
+		if err != nil {
+			t.Fatalf("Marshal: unexpected error: %v", err)
+		}
+		back, err := textpb.ParseJSON(bytes.NewReader(js))
+		if err != nil {
+			t.Fatalf("ParseJSON %s: unexpected error: %v", js, err)
+		}
+		if got, err := m.Encode(back); err != nil {
+			t.Errorf("Encode %s: unexpected error: %v", js, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("Encode %s:\n got %q\nwant %q", js, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// The methods below decode the value of a field as one of the protobuf scalar
+// types. Each reports an error if the wire type of the field does not match
+// the type requested, or if its data are malformed. As in the protobuf
+// encoding, 32-bit varint types are truncated from their 64-bit values.
+
+// AsUint64 decodes the value of a varint field as a uint64.
+func (f *Field) AsUint64() (uint64, error) {
+	if err := f.check(TVarint); err != nil {
+		return 0, err
+	} else if len(f.Data) > 8 {
+		return 0, fmt.Errorf("field %d: varint data too long (%d bytes)", f.ID, len(f.Data))
+	}
+	return Uint64(f.Data), nil
+}
+
+// AsUint32 decodes the value of a varint field as a uint32.
+func (f *Field) AsUint32() (uint32, error) {
+	v, err := f.AsUint64()
+	return uint32(v), err
+}
+
+// AsInt64 decodes the value of a varint field as an int64, in two's
+// complement.
+func (f *Field) AsInt64() (int64, error) {
+	v, err := f.AsUint64()
+	return int64(v), err
+}
+
+// AsInt32 decodes the value of a varint field as an int32, in two's
+// complement. This is also the representation of an enum value.
+func (f *Field) AsInt32() (int32, error) {
+	v, err := f.AsUint64()
+	return int32(v), err
+}
+
+// AsSint64 decodes the value of a varint field as a zig-zag encoded int64.
+func (f *Field) AsSint64() (int64, error) {
+	if _, err := f.AsUint64(); err != nil {
+		return 0, err
+	}
+	return Int64(f.Data), nil
+}
+
+// AsSint32 decodes the value of a varint field as a zig-zag encoded int32.
+func (f *Field) AsSint32() (int32, error) {
+	v, err := f.AsUint32()
+	return int32(v>>1) ^ -int32(v&1), err
+}
+
+// AsBool decodes the value of a varint field as a bool.
+func (f *Field) AsBool() (bool, error) {
+	v, err := f.AsUint64()
+	return v != 0, err
+}
+
+// AsFixed32 decodes the value of a fixed32 field as a uint32.
+func (f *Field) AsFixed32() (uint32, error) {
+	if err := f.checkLen(TFixed32, 4); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(f.Data), nil
+}
+
+// AsSfixed32 decodes the value of a fixed32 field as an int32.
+func (f *Field) AsSfixed32() (int32, error) {
+	v, err := f.AsFixed32()
+	return int32(v), err
+}
+
+// AsFloat decodes the value of a fixed32 field as a float32.
+func (f *Field) AsFloat() (float32, error) {
+	v, err := f.AsFixed32()
+	return math.Float32frombits(v), err
+}
+
+// AsFixed64 decodes the value of a fixed64 field as a uint64.
+func (f *Field) AsFixed64() (uint64, error) {
+	if err := f.checkLen(TFixed64, 8); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(f.Data), nil
+}
+
+// AsSfixed64 decodes the value of a fixed64 field as an int64.
+func (f *Field) AsSfixed64() (int64, error) {
+	v, err := f.AsFixed64()
+	return int64(v), err
+}
+
+// AsDouble decodes the value of a fixed64 field as a float64.
+func (f *Field) AsDouble() (float64, error) {
+	v, err := f.AsFixed64()
+	return math.Float64frombits(v), err
+}
+
+// AsString decodes the value of a delimited field as a string, which must be
+// valid UTF-8.
+func (f *Field) AsString() (string, error) {
+	if err := f.check(TDelimited); err != nil {
+		return "", err
+	} else if !utf8.Valid(f.Data) {
+		return "", fmt.Errorf("field %d: string is not valid UTF-8", f.ID)
+	}
+	return string(f.Data), nil
+}
+
+// AsBytes returns the value of a delimited field. The result shares storage
+// with f.Data.
+func (f *Field) AsBytes() ([]byte, error) {
+	if err := f.check(TDelimited); err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// check reports an error if f does not have wire type w.
+func (f *Field) check(w WireType) error {
+	if f.Wire != w {
+		return fmt.Errorf("field %d: wire type is %v, want %v", f.ID, f.Wire, w)
+	}
+	return nil
+}
+
+// checkLen reports an error if f does not have wire type w and n bytes of
+// data.
+func (f *Field) checkLen(w WireType, n int) error {
+	if err := f.check(w); err != nil {
+		return err
+	} else if len(f.Data) != n {
+		return fmt.Errorf("field %d: got %d bytes of %v data, want %d", f.ID, len(f.Data), w, n)
+	}
+	return nil
+}
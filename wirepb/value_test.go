@@ -0,0 +1,90 @@
+// Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
+
+package wirepb_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/creachadair/pson/wirepb"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccessors(t *testing.T) {
+	varint := func(v uint64) *wirepb.Field {
+		return &wirepb.Field{ID: 1, Wire: wirepb.TVarint, Data: wirepb.PutUint64(v)}
+	}
+	fixed32 := &wirepb.Field{ID: 2, Wire: wirepb.TFixed32, Data: []byte{0x00, 0x00, 0xc0, 0xbf}}
+	fixed64 := &wirepb.Field{ID: 3, Wire: wirepb.TFixed64, Data: []byte{0, 0, 0, 0, 0, 0, 0xf8, 0xbf}}
+	delim := &wirepb.Field{ID: 4, Wire: wirepb.TDelimited, Data: []byte("héllo")}
+
+	minus1 := varint(math.MaxUint64) // -1 as int32 or int64
+	tests := []struct {
+		desc string
+		get  func() (any, error)
+		want any
+	}{
+		{"uint64", func() (any, error) { return varint(300).AsUint64() }, uint64(300)},
+		{"uint32", func() (any, error) { return varint(1<<32 + 5).AsUint32() }, uint32(5)},
+		{"int64", func() (any, error) { return minus1.AsInt64() }, int64(-1)},
+		{"int32", func() (any, error) { return minus1.AsInt32() }, int32(-1)},
+		{"sint64", func() (any, error) { return varint(3).AsSint64() }, int64(-2)},
+		{"sint64 max", func() (any, error) { return minus1.AsSint64() }, int64(math.MinInt64)},
+		{"sint32", func() (any, error) { return varint(4).AsSint32() }, int32(2)},
+		{"sint32 min", func() (any, error) { return varint(math.MaxUint32).AsSint32() }, int32(math.MinInt32)},
+		{"bool true", func() (any, error) { return varint(1).AsBool() }, true},
+		{"bool false", func() (any, error) { return varint(0).AsBool() }, false},
+		{"fixed32", func() (any, error) { return fixed32.AsFixed32() }, uint32(0xbfc00000)},
+		{"sfixed32", func() (any, error) { return fixed32.AsSfixed32() }, int32(-1077936128)},
+		{"float", func() (any, error) { return fixed32.AsFloat() }, float32(-1.5)},
+		{"fixed64", func() (any, error) { return fixed64.AsFixed64() }, uint64(0xbff8000000000000)},
+		{"sfixed64", func() (any, error) { return fixed64.AsSfixed64() }, int64(-4613937818241073152)},
+		{"double", func() (any, error) { return fixed64.AsDouble() }, -1.5},
+		{"string", func() (any, error) { return delim.AsString() }, "héllo"},
+		{"bytes", func() (any, error) { return delim.AsBytes() }, []byte("héllo")},
+	}
+	for _, test := range tests {
+		got, err := test.get()
+		if err != nil {
+			t.Errorf("As %s: unexpected error: %v", test.desc, err)
+		} else if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("As %s (-want, +got):\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestAccessorErrors(t *testing.T) {
+	varint := &wirepb.Field{ID: 1, Wire: wirepb.TVarint, Data: []byte{1}}
+	delim := &wirepb.Field{ID: 2, Wire: wirepb.TDelimited, Data: []byte("\xff")}
+	tests := []struct {
+		desc string
+		get  func() error
+	}{
+		{"uint64 of delimited", func() error { _, err := delim.AsUint64(); return err }},
+		{"sint32 of delimited", func() error { _, err := delim.AsSint32(); return err }},
+		{"fixed32 of varint", func() error { _, err := varint.AsFixed32(); return err }},
+		{"double of varint", func() error { _, err := varint.AsDouble(); return err }},
+		{"string of varint", func() error { _, err := varint.AsString(); return err }},
+		{"bytes of varint", func() error { _, err := varint.AsBytes(); return err }},
+		{"invalid string", func() error { _, err := delim.AsString(); return err }},
+		{"long varint", func() error {
+			_, err := (&wirepb.Field{Wire: wirepb.TVarint, Data: make([]byte, 9)}).AsUint64()
+			return err
+		}},
+		{"short fixed32", func() error {
+			_, err := (&wirepb.Field{Wire: wirepb.TFixed32, Data: make([]byte, 3)}).AsFloat()
+			return err
+		}},
+		{"short fixed64", func() error {
+			_, err := (&wirepb.Field{Wire: wirepb.TFixed64, Data: make([]byte, 4)}).AsSfixed64()
+			return err
+		}},
+	}
+	for _, test := range tests {
+		if err := test.get(); err == nil {
+			t.Errorf("As %s: got nil, want error", test.desc)
+		} else {
+			t.Logf("As %s: got expected error: %v", test.desc, err)
+		}
+	}
+}
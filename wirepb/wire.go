@@ -1,7 +1,8 @@
 // Copyright (C) 2015 Michael J. Fromberger. All Rights Reserved.
 
-// Package wirepb supports decoding raw wire-format protobuf messages, where
-// "raw" means the decoding is done without knowledge of the schema.
+// Package wirepb supports decoding and encoding raw wire-format protobuf
+// messages, where "raw" means the work is done without knowledge of the
+// schema.
 package wirepb
 
 import (
@@ -12,6 +13,10 @@ import (
 	"math"
 )
 
+// maxGroupDepth is the deepest nesting of groups the decoders accept, as for
+// the protobuf libraries.
+const maxGroupDepth = 100
+
 // A Decoder consumes input from an io.Reader pointing to a wire-format
 // protobuf message.
 type Decoder struct {
@@ -21,8 +26,19 @@ type Decoder struct {
 // NewDecoder creates a new decoder that reads data from r.
 func NewDecoder(r io.Reader) Decoder { return Decoder{bufio.NewReader(r)} }
 
-// Next returns the next field in the message.
+// Next returns the next field in the message. A group is returned as a single
+// field of type TStartGroup whose data are the encoded fields of the group.
 func (d Decoder) Next() (*Field, error) {
+	f, err := d.next(0)
+	if err == nil && f.Wire == TEndGroup {
+		return nil, fmt.Errorf("end of group %d without a beginning", f.ID)
+	}
+	return f, err
+}
+
+// next returns the next field in the message, including the end marker of an
+// enclosing group. The depth is the number of groups enclosing the field.
+func (d Decoder) next(depth int) (*Field, error) {
 	v, err := binary.ReadUvarint(d.buf)
 	if err != nil {
 		return nil, err
@@ -51,6 +67,15 @@ func (d Decoder) Next() (*Field, error) {
 		}
 		f.Data = make([]byte, w)
 
+	case TStartGroup:
+		if depth >= maxGroupDepth {
+			return nil, errGroupDepth
+		}
+		return f, d.group(f, depth+1)
+
+	case TEndGroup:
+		return f, nil
+
 	case TFixed32:
 		f.Data = make([]byte, 4)
 
@@ -63,6 +88,24 @@ func (d Decoder) Next() (*Field, error) {
 	return f, nil
 }
 
+// group reads the fields of group f up to its end marker, and stores their
+// encoding in f.Data. The depth is the number of groups enclosing its fields.
+func (d Decoder) group(f *Field, depth int) error {
+	f.Data = []byte{}
+	for {
+		g, err := d.next(depth)
+		if err != nil {
+			return checkErr(err)
+		} else if g.Wire == TEndGroup {
+			if g.ID != f.ID {
+				return fmt.Errorf("end of group %d inside group %d", g.ID, f.ID)
+			}
+			return nil
+		}
+		f.Data = g.Pack(f.Data)
+	}
+}
+
 // A WireType represents the wire type of a field key
 type WireType int
 
@@ -71,14 +114,33 @@ const (
 	TVarint     WireType = 0 // varint-encoded value
 	TFixed64    WireType = 1 // fixed-width 64-bit value (LSB first)
 	TDelimited  WireType = 2 // length-prefixed value (varint + bytes)
-	TStartGroup WireType = 3 // deprecated, unused
-	TEndGroup   WireType = 4 // deprecated, unused
+	TStartGroup WireType = 3 // start of a group (deprecated)
+	TEndGroup   WireType = 4 // end of a group (deprecated)
 	TFixed32    WireType = 5 // fixed-width 32-bit value (LSB first)
 )
 
+var wireTypeName = [...]string{
+	TVarint:     "varint",
+	TFixed64:    "fixed64",
+	TDelimited:  "delimited",
+	TStartGroup: "start group",
+	TEndGroup:   "end group",
+	TFixed32:    "fixed32",
+}
+
+func (w WireType) String() string {
+	if w >= 0 && int(w) < len(wireTypeName) && wireTypeName[w] != "" {
+		return wireTypeName[w]
+	}
+	return fmt.Sprintf("WireType(%d)", int(w))
+}
+
 // A Field represents a field read from a wire-format message.  The data in the
 // field are returned as encoded. Further decoding into a higher-level schema
 // is the caller's responsibility.
+//
+// For a group, Wire is TStartGroup and Data contains the encoded fields of the
+// group, not including its start and end markers.
 type Field struct {
 	ID   int
 	Wire WireType
@@ -96,6 +158,8 @@ func (f *Field) Size() int {
 		return n + 8
 	case TDelimited:
 		return n + varintSize(uint64(len(f.Data))) + len(f.Data)
+	case TStartGroup:
+		return 2*n + len(f.Data)
 	case TFixed32:
 		return n + 4
 	default:
@@ -117,8 +181,8 @@ func (f *Field) Pack(buf []byte) []byte {
 }
 
 // PackValue encodes the value of f in wire format and appends the result to
-// buf, allowing the caller to control allocation. Returns nil if f cannot be
-// packed.
+// buf, allowing the caller to control allocation. The value of a group is its
+// contents followed by its end marker. Returns nil if f cannot be packed.
 func (f *Field) PackValue(buf []byte) []byte {
 	var bits [10]byte // buffer for varint encoding
 
@@ -138,6 +202,12 @@ func (f *Field) PackValue(buf []byte) []byte {
 	case TFixed32:
 		return appendN(buf, f.Data, 4)
 
+	case TStartGroup:
+		key := (uint64(f.ID) << 3) | uint64(TEndGroup)
+		n := binary.PutUvarint(bits[:], key)
+		buf = append(buf, f.Data...)
+		return append(buf, bits[:n]...)
+
 	default:
 		return nil
 	}
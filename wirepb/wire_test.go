@@ -3,10 +3,13 @@
 package wirepb_test
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"strings"
 	"testing"
 
+	"github.com/creachadair/pson/textpb"
 	"github.com/creachadair/pson/wirepb"
 	"github.com/google/go-cmp/cmp"
 )
@@ -59,6 +62,9 @@ func TestPacking(t *testing.T) {
 		{3, wirepb.TDelimited, "apple pie and cake", "\032\022apple pie and cake"},
 		{4, wirepb.TVarint, "ABCD", " \xc4\x86\x89\x8a\x04"},
 		{47, wirepb.TFixed32, "0123", "\xfd\x020123"},
+		{5, wirepb.TStartGroup, "\010\001", "\053\010\001\054"},
+		{6, wirepb.TStartGroup, "", "\063\064"},
+		{7, wirepb.TStartGroup, "\013\010\001\014", "\073\013\010\001\014\074"},
 	}
 	for _, test := range tests {
 		input := &wirepb.Field{ID: test.id, Wire: test.wire, Data: []byte(test.data)}
@@ -83,8 +89,10 @@ func TestErrors(t *testing.T) {
 	badInputs := []string{
 		"\010",       // missing varint length
 		"\050\x83",   // malformed varint length
-		"\023",       // unsupported wire type
-		"\034",       // unsupported wire type
+		"\023",       // unterminated group
+		"\034",       // end of group without a beginning
+		"\023\034",   // mismatched end of group
+		"\023\010",   // truncated field in group
 		"\046",       // unknown wire type
 		"\052\x0312", // truncated delimited field
 		"\061abcdef", // truncated fixed64
@@ -106,3 +114,68 @@ nextTest:
 		t.Errorf("Input %q: expected error, but succeeded", input)
 	}
 }
+
+func TestGroupDepth(t *testing.T) {
+	// nest returns n groups of field 1, each inside the last.
+	nest := func(n int) string { return strings.Repeat("\013", n) + strings.Repeat("\014", n) }
+
+	decoders := map[string]func(string) error{
+		"Decoder": func(s string) error {
+			_, err := wirepb.NewDecoder(strings.NewReader(s)).Next()
+			return err
+		},
+		"BytesDecoder": func(s string) error {
+			_, err := wirepb.NewBytesDecoder([]byte(s)).Next()
+			return err
+		},
+		"DecodeRaw": func(s string) error {
+			_, err := wirepb.DecodeRaw(strings.NewReader(s))
+			return err
+		},
+	}
+	for name, decode := range decoders {
+		if err := decode(nest(100)); err != nil {
+			t.Errorf("%s: 100 nested groups: unexpected error: %v", name, err)
+		}
+		if err := decode(nest(101)); err == nil {
+			t.Errorf("%s: 101 nested groups: got nil, want error", name)
+		}
+		if err := decode(strings.Repeat("\013", 5<<20)); err == nil {
+			t.Errorf("%s: unterminated groups: got nil, want error", name)
+		} else {
+			t.Logf("%s: got expected error: %v", name, err)
+		}
+	}
+}
+
+// nested returns n delimited values of field 1, each inside the last.
+func nested(n int) []byte {
+	lens := make([]int, n) // lens[i] is the length of the contents at level i
+	for i := n - 2; i >= 0; i-- {
+		lens[i] = 1 + len(binary.AppendUvarint(nil, uint64(lens[i+1]))) + lens[i+1]
+	}
+	var buf []byte
+	for _, n := range lens {
+		buf = append(buf, 012)
+		buf = binary.AppendUvarint(buf, uint64(n))
+	}
+	return buf
+}
+
+func TestRawDepth(t *testing.T) {
+	msg, err := wirepb.DecodeRaw(bytes.NewReader(nested(4 << 20)))
+	if err != nil {
+		t.Fatalf("DecodeRaw: unexpected error: %v", err)
+	}
+	depth := 0
+	for len(msg) != 0 && msg[0].Values[0].Msg != nil {
+		msg = msg[0].Values[0].Msg
+		depth++
+	}
+	if depth != 100 {
+		t.Errorf("DecodeRaw: got %d nested messages, want 100", depth)
+	}
+	if v := msg[0].Values[0]; v.Type != textpb.String {
+		t.Errorf("DecodeRaw: innermost value is %v, want a string", v)
+	}
+}